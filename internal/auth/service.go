@@ -111,6 +111,11 @@ func (s *Service) CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
+func IsPasswordHash(value string) bool {
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil
+}
+
 func (s *Service) CreateUser(req *RegisterRequest) (*User, error) {
 	// Hash password
 	hashedPassword, err := s.HashPassword(req.Password)
@@ -0,0 +1,261 @@
+// Package readability extrae el cuerpo de un artículo de una página HTML,
+// sin menús, barras laterales ni publicidad, y lo devuelve como HTML
+// saneado. Sigue la idea del modo lectura de los navegadores: se puntúan
+// los contenedores según el texto de sus párrafos y se queda el mejor.
+package readability
+
+import (
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Article es el resultado de la extracción
+type Article struct {
+	Title   string // og:title o <title>
+	Excerpt string // og:description o meta description
+	Content string // HTML saneado del cuerpo del artículo
+	Length  int    // Caracteres de texto de Content
+}
+
+var (
+	// Elementos que nunca forman parte del artículo
+	junkTags = "script, style, noscript, template, iframe, object, embed, canvas, svg, form, button, input, select, textarea, nav, aside, header, footer, link, meta"
+
+	// Clases e ids de bloques de relleno conocidos. Se salvan si además
+	// parecen contenido (maybeCandidate).
+	unlikely       = regexp.MustCompile(`(?i)-ad-|\bads?\b|advert|banner|breadcrumb|combx|comment|community|cookie|consent|disqus|footer|gdpr|header|menu|modal|newsletter|outbrain|pager|pagination|popup|promo|related|remark|replies|share|sharing|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|taboola|tweet|widget`)
+	maybeCandidate = regexp.MustCompile(`(?i)article|body|column|content|main|post|entry|story|text`)
+
+	// Pistas en clases e ids que suben o bajan la puntuación
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)-ad-|banner|combx|comment|com-|contact|foot|footnote|gdpr|masthead|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+
+	displayNone = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+
+	// Elementos de bloque: un <div> sin ninguno dentro es en realidad un párrafo
+	blockTags = "p, div, section, article, main, table, ul, ol, dl, pre, blockquote, h1, h2, h3, h4, h5, h6, figure, hr"
+)
+
+// Extract analiza la página leída de r. pageURL (puede ser nil) sirve para
+// resolver los enlaces e imágenes relativos.
+func Extract(r io.Reader, pageURL *url.URL) (Article, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return Article{}, err
+	}
+	base := pageURL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok && pageURL != nil {
+		if u, err := pageURL.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	article := Article{
+		Title:   firstNonEmpty(metaContent(doc, "og:title"), normalizeSpace(doc.Find("title").First().Text())),
+		Excerpt: firstNonEmpty(metaContent(doc, "og:description"), metaContent(doc, "description")),
+	}
+
+	removeJunk(doc)
+	divsToParagraphs(doc)
+
+	var out strings.Builder
+	s := sanitizer{base: base, out: &out}
+	for _, node := range contentNodes(doc) {
+		s.renderRoot(node)
+	}
+	article.Content = strings.TrimSpace(out.String())
+	article.Length = s.textLength
+	return article, nil
+}
+
+// removeJunk quita los elementos que no son contenido: por etiqueta, por
+// estar ocultos o por tener clases de bloques de relleno.
+func removeJunk(doc *goquery.Document) {
+	doc.Find(junkTags).Remove()
+	doc.Find("[hidden], [aria-hidden=true]").Remove()
+	doc.Find("[style]").Each(func(_ int, s *goquery.Selection) {
+		if displayNone.MatchString(s.AttrOr("style", "")) {
+			s.Remove()
+		}
+	})
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		switch goquery.NodeName(s) {
+		case "html", "body", "article", "main", "a":
+			return
+		}
+		match := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikely.MatchString(match) && !maybeCandidate.MatchString(match) {
+			s.Remove()
+		}
+	})
+}
+
+// divsToParagraphs convierte en <p> los <div> que sólo tienen texto y
+// elementos en línea, muy habituales en páginas antiguas.
+func divsToParagraphs(doc *goquery.Document) {
+	doc.Find("div").Each(func(_ int, s *goquery.Selection) {
+		if s.Find(blockTags).Length() == 0 && normalizeSpace(s.Text()) != "" {
+			node := s.Get(0)
+			node.Data = "p"
+			node.DataAtom = atom.P
+		}
+	})
+}
+
+// contentNodes elige el contenedor con mejor puntuación y le suma los
+// hermanos que también parecen parte del artículo.
+func contentNodes(doc *goquery.Document) []*html.Node {
+	scores := make(map[*html.Node]float64)
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, p *goquery.Selection) {
+		text := normalizeSpace(p.Text())
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return
+		}
+		// Un punto por párrafo, uno por coma y hasta tres por longitud
+		points := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length)/100, 3)
+		parent := p.Parent()
+		for level, ancestor := range []*goquery.Selection{parent, parent.Parent()} {
+			if ancestor.Length() == 0 || goquery.NodeName(ancestor) == "html" {
+				continue
+			}
+			node := ancestor.Get(0)
+			if _, ok := scores[node]; !ok {
+				scores[node] = initialScore(ancestor)
+			}
+			if level == 0 {
+				scores[node] += points
+			} else {
+				scores[node] += points / 2
+			}
+		}
+	})
+
+	// Los contenedores llenos de enlaces (menús, listas de artículos) pierden
+	// puntos. Se recorren en orden del documento: a igual puntuación gana el
+	// primero.
+	var top *html.Node
+	best := 0.0
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		node := s.Get(0)
+		score, ok := scores[node]
+		if !ok {
+			return
+		}
+		score *= 1 - linkDensity(s)
+		scores[node] = score
+		if top == nil || score > best {
+			top, best = node, score
+		}
+	})
+	if top == nil {
+		return doc.Find("body").Nodes
+	}
+	if top.Parent == nil {
+		return []*html.Node{top}
+	}
+
+	threshold := math.Max(10, best*0.2)
+	var nodes []*html.Node
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if sibling == top || scores[sibling] >= threshold || isContentParagraph(sibling) {
+			nodes = append(nodes, sibling)
+		}
+	}
+	return nodes
+}
+
+// initialScore puntúa un candidato por su etiqueta y sus clases
+func initialScore(s *goquery.Selection) float64 {
+	score := classWeight(s)
+	switch goquery.NodeName(s) {
+	case "div", "article", "main", "section":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+// classWeight suma o resta 25 según las pistas de class e id
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, value := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if value == "" {
+			continue
+		}
+		if negative.MatchString(value) {
+			weight -= 25
+		}
+		if positive.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// isContentParagraph acepta párrafos hermanos del candidato que no tienen
+// puntuación propia pero son texto corrido con pocos enlaces.
+func isContentParagraph(node *html.Node) bool {
+	if node.Data != "p" {
+		return false
+	}
+	s := goquery.NewDocumentFromNode(node).Selection
+	text := normalizeSpace(s.Text())
+	length := utf8.RuneCountInString(text)
+	density := linkDensity(s)
+	switch {
+	case length > 80:
+		return density < 0.25
+	case length > 0:
+		last, _ := utf8.DecodeLastRuneInString(text)
+		return density == 0 && strings.ContainsRune(".!?", last)
+	}
+	return false
+}
+
+// linkDensity es la proporción del texto que está dentro de enlaces
+func linkDensity(s *goquery.Selection) float64 {
+	length := utf8.RuneCountInString(normalizeSpace(s.Text()))
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += utf8.RuneCountInString(normalizeSpace(a.Text()))
+	})
+	return float64(links) / float64(length)
+}
+
+func metaContent(doc *goquery.Document, name string) string {
+	selector := `meta[property="` + name + `"], meta[name="` + name + `"]`
+	return normalizeSpace(doc.Find(selector).First().AttrOr("content", ""))
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package readability
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Párrafo largo con comas para que su contenedor puntúe como artículo
+const lorem = "El mercado libre coordina, sin planificador central, millones de decisiones, precios, salarios y planes de producción, y lo hace mejor que cualquier comité."
+
+func extract(t *testing.T, page string) Article {
+	t.Helper()
+	base, _ := url.Parse("https://example.com/blog/post.html")
+	article, err := Extract(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	return article
+}
+
+func TestSanitizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "script",
+			body:    `<p>` + lorem + `<script>alert("x")</script></p>`,
+			want:    []string{"El mercado libre"},
+			notWant: []string{"<script", "alert"},
+		},
+		{
+			name:    "on attributes",
+			body:    `<p onclick="steal()">` + lorem + `</p><img src="/a.png" onerror="steal()" alt="foto">`,
+			want:    []string{`<img src="https://example.com/a.png" loading="lazy" alt="foto">`},
+			notWant: []string{"onclick", "onerror", "steal"},
+		},
+		{
+			name:    "javascript links",
+			body:    `<p>` + lorem + ` <a href="javascript:steal()">pulsa</a> <a href=" JavaScript:steal()">aquí</a></p>`,
+			want:    []string{"pulsa", "aquí"},
+			notWant: []string{"javascript", "JavaScript", "href"},
+		},
+		{
+			name:    "javascript image",
+			body:    `<p>` + lorem + `</p><img src="javascript:steal()" alt="x">`,
+			notWant: []string{"<img", "javascript"},
+		},
+		{
+			name:    "relative link",
+			body:    `<p>` + lorem + ` <a href="../otro.html">otro</a> <a href="#nota">nota</a></p>`,
+			want:    []string{`<a href="https://example.com/otro.html" target="_blank" rel="noopener noreferrer">otro</a>`, " nota"},
+			notWant: []string{`href="#nota"`},
+		},
+		{
+			name:    "style and unknown tags",
+			body:    `<p style="color:red"><font color="red">` + lorem + `</font></p><style>p{}</style>`,
+			want:    []string{"<p>El mercado libre"},
+			notWant: []string{"style", "<font", "p{}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			article := extract(t, `<html><body><article>`+tt.body+`</article></body></html>`)
+			for _, want := range tt.want {
+				if !strings.Contains(article.Content, want) {
+					t.Errorf("content missing %q:\n%s", want, article.Content)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(article.Content, notWant) {
+					t.Errorf("content contains %q:\n%s", notWant, article.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestCandidateSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "article over sidebar and menu",
+			page: `<body>
+				<div class="menu"><a href="/a">Inicio</a> <a href="/b">Archivo</a></div>
+				<div class="sidebar"><p>` + lorem + `</p></div>
+				<div class="post-content"><p>Primero. ` + lorem + `</p><p>Segundo. ` + lorem + `</p></div>
+			</body>`,
+			want:    []string{"Primero.", "Segundo."},
+			notWant: []string{"Inicio", "Archivo"},
+		},
+		{
+			name: "link list loses to text",
+			page: `<body>
+				<div><p><a href="/1">` + lorem + `</a></p><p><a href="/2">` + lorem + `</a></p></div>
+				<div><p>Texto. ` + lorem + `</p></div>
+			</body>`,
+			want: []string{"Texto."},
+		},
+		{
+			name: "content sibling paragraphs",
+			page: `<body><div>
+				<div class="entry"><p>Cuerpo. ` + lorem + `</p><p>Más. ` + lorem + `</p></div>
+				<p>Nota final corta.</p>
+				<p>Sin punto final</p>
+			</div></body>`,
+			want:    []string{"Cuerpo.", "Nota final corta."},
+			notWant: []string{"Sin punto final"},
+		},
+		{
+			name: "ties go to the first in the document",
+			page: `<body>
+				<section><div><p>Alfa. ` + lorem + `</p></div></section>
+				<section><div><p>Beta. ` + lorem + `</p></div></section>
+			</body>`,
+			want:    []string{"Alfa."},
+			notWant: []string{"Beta."},
+		},
+		{
+			name: "no candidates falls back to body",
+			page: `<body><h1>Título</h1><span>corto</span></body>`,
+			want: []string{"corto"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Se repite para detectar elecciones que dependan del orden de un map
+			for range 5 {
+				article := extract(t, `<html>`+tt.page+`</html>`)
+				for _, want := range tt.want {
+					if !strings.Contains(article.Content, want) {
+						t.Fatalf("content missing %q:\n%s", want, article.Content)
+					}
+				}
+				for _, notWant := range tt.notWant {
+					if strings.Contains(article.Content, notWant) {
+						t.Fatalf("content contains %q:\n%s", notWant, article.Content)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIsContentParagraph(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want bool
+	}{
+		{"short sentence", `<p>Una frase corta.</p>`, true},
+		{"question", `<p>¿De verdad?</p>`, true},
+		{"no final punctuation", `<p>Sin punto final</p>`, false},
+		{"multibyte ending", `<p>Termina en acento é</p>`, false},
+		{"ellipsis", `<p>Y entonces…</p>`, false},
+		{"short with link", `<p><a href="/x">Enlace</a> suelto.</p>`, false},
+		{"long text", `<p>` + lorem + `</p>`, true},
+		{"long link list", `<p><a href="/x">` + lorem + `</a></p>`, false},
+		{"not a paragraph", `<div>Una frase corta.</div>`, false},
+		{"empty", `<p> </p>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<body>` + tt.html + `</body>`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			node := doc.Find("body").Children().Get(0)
+			if got := isContentParagraph(node); got != tt.want {
+				t.Errorf("isContentParagraph(%s) = %v, want %v", tt.html, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package readability
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Etiquetas que se conservan en el HTML de salida. Las demás se desenvuelven:
+// se pierde la etiqueta pero no su contenido.
+var allowedTags = map[string]bool{
+	"p": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"a": true, "img": true, "figure": true, "figcaption": true,
+	"pre": true, "code": true, "kbd": true, "samp": true, "blockquote": true, "q": true, "cite": true,
+	"em": true, "strong": true, "b": true, "i": true, "u": true, "s": true, "del": true, "ins": true,
+	"sub": true, "sup": true, "small": true, "mark": true, "abbr": true, "time": true,
+	"table": true, "caption": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "th": true, "td": true,
+}
+
+// Atributos permitidos por etiqueta (href y src se tratan aparte)
+var allowedAttrs = map[string][]string{
+	"img":  {"alt", "title"},
+	"abbr": {"title"},
+	"ol":   {"start"},
+	"td":   {"colspan", "rowspan"},
+	"th":   {"colspan", "rowspan"},
+}
+
+// Contenedores que se revisan antes de incluirlos: si parecen un bloque de
+// enlaces o de relleno dentro del artículo se descartan.
+var conditionalTags = map[string]bool{
+	"div": true, "section": true, "ul": true, "ol": true, "table": true, "dl": true,
+}
+
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// Etiquetas que no se escriben si quedan vacías
+var dropIfEmpty = map[string]bool{
+	"p": true, "a": true, "li": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "dl": true, "blockquote": true, "figure": true, "table": true, "em": true, "strong": true, "b": true, "i": true,
+}
+
+// sanitizer escribe en out el HTML de los nodos con sólo las etiquetas y
+// atributos permitidos, y con las URLs resueltas contra base.
+type sanitizer struct {
+	base       *url.URL
+	out        *strings.Builder
+	root       *html.Node // El contenedor elegido no se revisa como relleno
+	inPre      int
+	textLength int
+}
+
+// renderRoot escribe uno de los nodos elegidos como contenido
+func (s *sanitizer) renderRoot(n *html.Node) {
+	s.root = n
+	s.render(n)
+}
+
+func (s *sanitizer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		s.text(n.Data)
+	case html.ElementNode:
+		s.element(n)
+	case html.DocumentNode:
+		s.children(n)
+	}
+}
+
+func (s *sanitizer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s.render(c)
+	}
+}
+
+func (s *sanitizer) text(text string) {
+	if s.inPre == 0 {
+		// Fuera de <pre> los espacios y saltos de línea seguidos son uno,
+		// conservando el de los extremos para no pegar palabras
+		collapsed := strings.Join(strings.Fields(text), " ")
+		switch {
+		case collapsed == "" && text != "":
+			collapsed = " "
+		case collapsed != "":
+			if strings.TrimLeftFunc(text, unicode.IsSpace) != text {
+				collapsed = " " + collapsed
+			}
+			if strings.TrimRightFunc(text, unicode.IsSpace) != text {
+				collapsed += " "
+			}
+		}
+		text = collapsed
+	}
+	s.textLength += utf8.RuneCountInString(strings.TrimSpace(text))
+	s.out.WriteString(html.EscapeString(text))
+}
+
+func (s *sanitizer) element(n *html.Node) {
+	tag := n.Data
+	if n != s.root && conditionalTags[tag] && isBoilerplate(goquery.NewDocumentFromNode(n).Selection) {
+		return
+	}
+	if !allowedTags[tag] {
+		s.children(n)
+		return
+	}
+
+	attrs := s.attributes(n)
+	switch tag {
+	case "img":
+		if !strings.Contains(attrs, " src=") {
+			return
+		}
+	case "a":
+		// Anclas internas o enlaces no http: sólo el texto
+		if !strings.Contains(attrs, " href=") {
+			s.children(n)
+			return
+		}
+	case "h1":
+		// El título ya se muestra aparte; dentro del artículo baja un nivel
+		tag = "h2"
+	}
+	if voidTags[tag] {
+		s.out.WriteString("<" + tag + attrs + ">")
+		return
+	}
+
+	// Los hijos se escriben aparte para poder descartar elementos vacíos
+	outer := s.out
+	var inner strings.Builder
+	s.out = &inner
+	if tag == "pre" {
+		s.inPre++
+	}
+	s.children(n)
+	if tag == "pre" {
+		s.inPre--
+	}
+	s.out = outer
+	if dropIfEmpty[tag] && strings.TrimSpace(inner.String()) == "" {
+		return
+	}
+	s.out.WriteString("<" + tag + attrs + ">" + inner.String() + "</" + tag + ">")
+}
+
+// attributes devuelve los atributos permitidos de n ya escapados, con un
+// espacio delante de cada uno.
+func (s *sanitizer) attributes(n *html.Node) string {
+	var b strings.Builder
+	write := func(name, value string) {
+		b.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+	switch n.Data {
+	case "a":
+		if href := s.resolve(attr(n, "href"), true); href != "" {
+			write("href", href)
+			write("target", "_blank")
+			write("rel", "noopener noreferrer")
+		}
+	case "img":
+		// Las imágenes con carga diferida guardan la URL real en data-*
+		for _, name := range []string{"data-src", "data-lazy-src", "data-original", "src", "srcset"} {
+			value := attr(n, name)
+			if fields := strings.Fields(value); name == "srcset" && len(fields) > 0 {
+				value = fields[0]
+			}
+			if src := s.resolve(value, false); src != "" {
+				write("src", src)
+				write("loading", "lazy")
+				break
+			}
+		}
+	}
+	for _, name := range allowedAttrs[n.Data] {
+		if value := attr(n, name); value != "" {
+			write(name, value)
+		}
+	}
+	return b.String()
+}
+
+// resolve convierte raw en una URL absoluta http(s) (o mailto: si es un
+// enlace). Devuelve "" si no es válida o es un ancla de la propia página.
+func (s *sanitizer) resolve(raw string, link bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(raw, "#") {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if s.base != nil {
+		u = s.base.ResolveReference(u)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.String()
+	case "mailto":
+		if link {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// isBoilerplate decide si un contenedor dentro del artículo es relleno:
+// clases negativas o demasiados enlaces para el texto que tiene.
+func isBoilerplate(s *goquery.Selection) bool {
+	weight := classWeight(s)
+	if weight < 0 {
+		return true
+	}
+	text := normalizeSpace(s.Text())
+	// Los bloques con mucho texto corrido son contenido seguro
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+	if s.Find("pre, code").Length() > 0 && goquery.NodeName(s) != "ul" && goquery.NodeName(s) != "ol" {
+		return false
+	}
+	density := linkDensity(s)
+	return (weight < 25 && density > 0.2 && utf8.RuneCountInString(text) < 500) || density > 0.5
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+// Package rules evalúa las reglas de filtrado de cada usuario sobre los
+// artículos recién descargados: silenciar, marcar como leído, guardar en
+// SAVED/LOVED, etiquetar o marcar como prioritario.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"ancap-web/internal/search"
+	"ancap-web/internal/storage"
+)
+
+// Campos del artículo que puede mirar una regla
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldSource      = "source"
+	FieldAuthor      = "author"
+	FieldAny         = "any" // Cualquiera de los anteriores
+)
+
+// Formas de escribir el patrón
+const (
+	MatchKeywords = "keywords" // Palabras o frases separadas por comas; basta una
+	MatchRegex    = "regex"    // Expresión regular (sintaxis RE2)
+)
+
+// Acciones
+const (
+	ActionHide     = "hide"
+	ActionRead     = "read"
+	ActionSave     = "save"
+	ActionLove     = "love"
+	ActionTag      = "tag"
+	ActionPriority = "priority"
+)
+
+var (
+	fields  = []string{FieldTitle, FieldDescription, FieldSource, FieldAuthor, FieldAny}
+	actions = []string{ActionHide, ActionRead, ActionSave, ActionLove, ActionTag, ActionPriority}
+)
+
+// Rule es una regla ya validada y con el patrón compilado
+type Rule struct {
+	storage.Rule
+	re *regexp.Regexp
+}
+
+// Normalize limpia los campos de rule (espacios, mayúsculas, acciones
+// repetidas) antes de validarla y guardarla
+func Normalize(rule storage.Rule) storage.Rule {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Field = strings.ToLower(strings.TrimSpace(rule.Field))
+	rule.Match = strings.ToLower(strings.TrimSpace(rule.Match))
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Tag = strings.Join(strings.Fields(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rule.Tag), "#"))), "-")
+	var normalized []string
+	for _, action := range rule.Actions {
+		action = strings.ToLower(strings.TrimSpace(action))
+		if !slices.Contains(normalized, action) {
+			normalized = append(normalized, action)
+		}
+	}
+	rule.Actions = normalized
+	if rule.Field == "" {
+		rule.Field = FieldAny
+	}
+	if rule.Match == "" {
+		rule.Match = MatchKeywords
+	}
+	return rule
+}
+
+// Compile valida rule y compila su patrón
+func Compile(rule storage.Rule) (*Rule, error) {
+	if !slices.Contains(fields, rule.Field) {
+		return nil, fmt.Errorf("invalid field %q (use %s)", rule.Field, strings.Join(fields, ", "))
+	}
+	if rule.Pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+	if len(rule.Actions) == 0 {
+		return nil, errors.New("no actions")
+	}
+	for _, action := range rule.Actions {
+		if !slices.Contains(actions, action) {
+			return nil, fmt.Errorf("invalid action %q (use %s)", action, strings.Join(actions, ", "))
+		}
+	}
+	if slices.Contains(rule.Actions, ActionTag) && rule.Tag == "" {
+		return nil, errors.New("tag action without tag")
+	}
+
+	var expr string
+	switch rule.Match {
+	case MatchRegex:
+		expr = "(?i)" + rule.Pattern
+	case MatchKeywords:
+		var keywords []string
+		for _, keyword := range strings.Split(rule.Pattern, ",") {
+			if keyword = strings.Join(strings.Fields(keyword), " "); keyword != "" {
+				keywords = append(keywords, regexp.QuoteMeta(keyword))
+			}
+		}
+		if len(keywords) == 0 {
+			return nil, errors.New("empty pattern")
+		}
+		// Palabras completas: \b sólo entiende ASCII y fallaría con acentos
+		expr = `(?i)(?:^|[^\pL\pN_])(?:` + strings.Join(keywords, "|") + `)(?:$|[^\pL\pN_])`
+	default:
+		return nil, fmt.Errorf("invalid match %q (use %s or %s)", rule.Match, MatchKeywords, MatchRegex)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return &Rule{Rule: rule, re: re}, nil
+}
+
+// Matches indica si el artículo cumple la regla
+func (r *Rule) Matches(a storage.Article) bool {
+	for _, field := range []string{FieldTitle, FieldDescription, FieldSource, FieldAuthor} {
+		if r.Field != FieldAny && r.Field != field {
+			continue
+		}
+		if r.re.MatchString(fieldText(a, field)) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldText(a storage.Article, field string) string {
+	switch field {
+	case FieldTitle:
+		return a.Title
+	case FieldDescription:
+		// La descripción suele ser HTML: sólo cuenta el texto
+		return search.PlainText(a.Description)
+	case FieldSource:
+		return a.Source
+	case FieldAuthor:
+		return a.Author
+	}
+	return ""
+}
+
+// Set son las reglas activas de un usuario
+type Set []*Rule
+
+// CompileAll compila las reglas activas. Las que no son válidas se saltan y
+// se devuelven sus errores.
+func CompileAll(list []storage.Rule) (Set, error) {
+	var set Set
+	var errs []error
+	for _, rule := range list {
+		if !rule.Enabled {
+			continue
+		}
+		compiled, err := Compile(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+			continue
+		}
+		set = append(set, compiled)
+	}
+	return set, errors.Join(errs...)
+}
+
+// Outcome es el resultado de aplicar todas las reglas a un artículo
+type Outcome struct {
+	Mark  storage.ArticleMark
+	Save  bool
+	Love  bool
+	Rules []string // IDs de las reglas que coincidieron
+}
+
+// Evaluate aplica todas las reglas del conjunto a un artículo. Las
+// acciones se suman.
+func (s Set) Evaluate(a storage.Article) Outcome {
+	var outcome Outcome
+	for _, rule := range s {
+		if !rule.Matches(a) {
+			continue
+		}
+		outcome.Rules = append(outcome.Rules, rule.ID)
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionHide:
+				outcome.Mark.Hidden = true
+			case ActionRead:
+				outcome.Mark.Read = true
+			case ActionPriority:
+				outcome.Mark.Priority = true
+			case ActionTag:
+				if !slices.Contains(outcome.Mark.Tags, rule.Tag) {
+					outcome.Mark.Tags = append(outcome.Mark.Tags, rule.Tag)
+				}
+			case ActionSave:
+				outcome.Save = true
+			case ActionLove:
+				outcome.Love = true
+			}
+		}
+	}
+	return outcome
+}
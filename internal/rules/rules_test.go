@@ -0,0 +1,185 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"ancap-web/internal/storage"
+)
+
+func TestCompileErrors(t *testing.T) {
+	valid := storage.Rule{Field: FieldAny, Match: MatchKeywords, Pattern: "bitcoin", Actions: []string{ActionHide}}
+	tests := []struct {
+		name    string
+		modify  func(*storage.Rule)
+		wantErr string
+	}{
+		{"valid", func(r *storage.Rule) {}, ""},
+		{"valid regex", func(r *storage.Rule) { r.Match, r.Pattern = MatchRegex, `^\[sponsored\]` }, ""},
+		{"bad field", func(r *storage.Rule) { r.Field = "body" }, `invalid field "body"`},
+		{"empty pattern", func(r *storage.Rule) { r.Pattern = "" }, "empty pattern"},
+		{"only commas", func(r *storage.Rule) { r.Pattern = " , ," }, "empty pattern"},
+		{"no actions", func(r *storage.Rule) { r.Actions = nil }, "no actions"},
+		{"bad action", func(r *storage.Rule) { r.Actions = []string{"delete"} }, `invalid action "delete"`},
+		{"tag without tag", func(r *storage.Rule) { r.Actions = []string{ActionTag} }, "tag action without tag"},
+		{"bad match", func(r *storage.Rule) { r.Match = "glob" }, `invalid match "glob"`},
+		{"bad regex", func(r *storage.Rule) { r.Match, r.Pattern = MatchRegex, "(bitcoin" }, "invalid regex: "},
+		{"unsupported regex", func(r *storage.Rule) { r.Match, r.Pattern = MatchRegex, `(?=bitcoin)` }, "invalid regex: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.modify(&rule)
+			_, err := Compile(rule)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Compile() error = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+				t.Errorf("Compile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeywordMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		title   string
+		want    bool
+	}{
+		{"estado", "El Estado crece otra vez", true},
+		{"estado", "Acuerdo estadounidense", false},
+		{"estado", "Desestado", false},
+		{"acción", "Una acción.", true},
+		{"acción", "Reacción del mercado", false},
+		{"ACCIÓN", "la acción humana", true},
+		{"café", "Precio del café, en máximos", true},
+		{"café", "Cafés de especialidad", false},
+		{"españa", "¡España!", true},
+		{"ñu", "Un ñu en la sabana", true},
+		{"ñu", "Cañuto", false},
+		{"banco central", "El Banco Central sube tipos", true},
+		{"bitcoin, monero", "Monero sube", true},
+		{"c++", "Novedades de C++ 26", true},
+		{"btc", "btc_usd", false},
+	}
+	for _, tt := range tests {
+		rule, err := Compile(storage.Rule{Field: FieldTitle, Match: MatchKeywords, Pattern: tt.pattern, Actions: []string{ActionHide}})
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.pattern, err)
+		}
+		if got := rule.Matches(storage.Article{Title: tt.title}); got != tt.want {
+			t.Errorf("keywords %q on %q = %v, want %v", tt.pattern, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesFields(t *testing.T) {
+	article := storage.Article{
+		Title:       "Nuevo récord",
+		Description: `<p>El <b>banco central</b> imprime</p><script>bitcoin()</script>`,
+		Source:      "Mises Wire",
+		Author:      "Ludwig",
+	}
+	tests := []struct {
+		field   string
+		pattern string
+		want    bool
+	}{
+		{FieldTitle, "récord", true},
+		{FieldTitle, "mises", false},
+		{FieldDescription, "banco central", true},
+		{FieldDescription, "bitcoin", false},
+		{FieldDescription, "b", false},
+		{FieldSource, "mises wire", true},
+		{FieldAuthor, "ludwig", true},
+		{FieldAny, "ludwig", true},
+		{FieldAny, "hayek", false},
+	}
+	for _, tt := range tests {
+		rule, err := Compile(storage.Rule{Field: tt.field, Match: MatchKeywords, Pattern: tt.pattern, Actions: []string{ActionHide}})
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.pattern, err)
+		}
+		if got := rule.Matches(article); got != tt.want {
+			t.Errorf("%s ~ %q = %v, want %v", tt.field, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got := Normalize(storage.Rule{
+		Name:    "  Cripto ",
+		Pattern: " bitcoin ",
+		Actions: []string{"Tag", " tag", "HIDE"},
+		Tag:     " #Cripto Monedas ",
+	})
+	want := storage.Rule{
+		Name:    "Cripto",
+		Field:   FieldAny,
+		Match:   MatchKeywords,
+		Pattern: "bitcoin",
+		Actions: []string{ActionTag, ActionHide},
+		Tag:     "cripto-monedas",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	list := []storage.Rule{
+		{ID: "hide", Field: FieldTitle, Match: MatchKeywords, Pattern: "sorteo", Actions: []string{ActionHide, ActionRead}, Enabled: true},
+		{ID: "tag", Field: FieldAny, Match: MatchRegex, Pattern: `\bbtc\b|bitcoin`, Actions: []string{ActionTag, ActionPriority}, Tag: "cripto", Enabled: true},
+		{ID: "tag-again", Field: FieldTitle, Match: MatchKeywords, Pattern: "bitcoin", Actions: []string{ActionTag, ActionSave}, Tag: "cripto", Enabled: true},
+		{ID: "disabled", Field: FieldAny, Match: MatchKeywords, Pattern: "bitcoin", Actions: []string{ActionLove}, Enabled: false},
+		{ID: "invalid", Name: "rota", Field: FieldAny, Match: MatchRegex, Pattern: "(", Actions: []string{ActionHide}, Enabled: true},
+		{ID: "invalid-disabled", Field: FieldAny, Match: MatchRegex, Pattern: "(", Actions: []string{ActionHide}, Enabled: false},
+	}
+	set, err := CompileAll(list)
+	if err == nil || !strings.Contains(err.Error(), `rule "rota"`) || strings.Count(err.Error(), "rule ") != 1 {
+		t.Errorf("CompileAll() error = %v, want only the enabled invalid rule", err)
+	}
+	var ids []string
+	for _, rule := range set {
+		ids = append(ids, rule.ID)
+	}
+	if want := []string{"hide", "tag", "tag-again"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("CompileAll() = %v, want %v", ids, want)
+	}
+
+	tests := []struct {
+		name  string
+		title string
+		want  Outcome
+	}{
+		{"no match", "Hayek y los precios", Outcome{}},
+		{
+			name:  "hide and read",
+			title: "Gran sorteo",
+			want:  Outcome{Mark: storage.ArticleMark{Hidden: true, Read: true}, Rules: []string{"hide"}},
+		},
+		{
+			name:  "actions add up and tags are not repeated",
+			title: "Bitcoin: gran sorteo",
+			want: Outcome{
+				Mark:  storage.ArticleMark{Hidden: true, Read: true, Priority: true, Tags: []string{"cripto"}},
+				Save:  true,
+				Rules: []string{"hide", "tag", "tag-again"},
+			},
+		},
+		{
+			name:  "disabled rule does not love",
+			title: "Bitcoin en máximos",
+			want:  Outcome{Mark: storage.ArticleMark{Priority: true, Tags: []string{"cripto"}}, Save: true, Rules: []string{"tag", "tag-again"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := set.Evaluate(storage.Article{Title: tt.title}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate(%q) = %+v, want %+v", tt.title, got, tt.want)
+			}
+		})
+	}
+}
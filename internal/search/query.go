@@ -0,0 +1,169 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Query es una búsqueda ya interpretada. Todas las condiciones se tienen
+// que cumplir a la vez.
+type Query struct {
+	Terms   []string   // Palabras sueltas
+	Phrases []string   // "frases exactas"
+	Either  [][]string // a OR b: basta con que se cumpla una de cada grupo
+	Exclude []string   // -palabra o -"frase"
+	Sources []string   // source:nombre
+	After   time.Time  // after:AAAA-MM-DD, desde ese día incluido
+	Before  time.Time  // before:AAAA-MM-DD, hasta ese día sin incluirlo
+}
+
+// IsEmpty indica que no hay nada que buscar. Una búsqueda sólo con
+// exclusiones no está vacía: es todo lo visible menos lo excluido.
+func (q Query) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.Either) == 0 && len(q.Exclude) == 0 && len(q.Sources) == 0 && q.After.IsZero() && q.Before.IsZero()
+}
+
+// ParseQuery interpreta la sintaxis de búsqueda: palabras, "frases",
+// -exclusiones, source:fuente (o source:"dos palabras"), after:fecha y
+// before:fecha. Todo tiene que cumplirse (AND es opcional) salvo las
+// palabras o frases unidas con OR. Las fechas son AAAA-MM-DD en location.
+// Si hay errores se devuelve además lo que sí se pudo interpretar.
+func ParseQuery(input string, location *time.Location) (Query, error) {
+	var q Query
+	var errs []error
+	// Palabras y frases en orden; cada una con las alternativas unidas por OR
+	var clauses [][]string
+	or := false
+	positive := func(text string) {
+		if or && len(clauses) > 0 {
+			clauses[len(clauses)-1] = append(clauses[len(clauses)-1], text)
+		} else {
+			clauses = append(clauses, []string{text})
+		}
+		or = false
+	}
+	for _, token := range tokenize(input) {
+		if !token.quoted && (token.head == "AND" || token.head == "OR") {
+			or = token.head == "OR"
+			continue
+		}
+		head, negated := strings.CutPrefix(token.head, "-")
+		if key, value, ok := strings.Cut(head, ":"); ok && !negated && operators[strings.ToLower(key)] {
+			key = strings.ToLower(key)
+			if token.quoted {
+				value = token.quote
+			}
+			if value == "" {
+				continue
+			}
+			if key == "source" {
+				q.Sources = append(q.Sources, value)
+				continue
+			}
+			t, err := time.ParseInLocation("2006-01-02", value, location)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s date %q", key, value))
+				continue
+			}
+			if key == "after" {
+				q.After = t
+			} else {
+				q.Before = t
+			}
+			continue
+		}
+
+		switch {
+		case token.quoted && token.quote == "":
+		case token.quoted && negated:
+			q.Exclude = append(q.Exclude, token.quote)
+		case token.quoted:
+			positive(token.quote)
+		case negated && head != "":
+			q.Exclude = append(q.Exclude, head)
+		case head != "":
+			positive(head)
+		}
+	}
+	for _, clause := range clauses {
+		switch {
+		case len(clause) > 1:
+			q.Either = append(q.Either, clause)
+		case strings.Contains(clause[0], " "):
+			q.Phrases = append(q.Phrases, clause[0])
+		default:
+			q.Terms = append(q.Terms, clause[0])
+		}
+	}
+	return q, errors.Join(errs...)
+}
+
+var operators = map[string]bool{"source": true, "after": true, "before": true}
+
+// queryToken es una palabra o, si quoted, lo que va pegado delante de unas
+// comillas (head, p. ej. "source:" o "-") y su contenido (quote).
+type queryToken struct {
+	head   string
+	quote  string
+	quoted bool
+}
+
+// tokenize separa input por espacios respetando las comillas
+func tokenize(input string) []queryToken {
+	var tokens []queryToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '"' {
+			i++
+		}
+		token := queryToken{head: string(runes[start:i])}
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			token.quote = strings.Join(strings.Fields(string(runes[i+1:end])), " ")
+			token.quoted = true
+			i = end + 1
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// PlainText convierte un fragmento HTML en texto para indexarlo
+func PlainText(fragment string) string {
+	var b strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(tokenizer.Text())
+			}
+		}
+		// Las etiquetas separan palabras ("a</p><p>b" no es "ab")
+		b.WriteByte(' ')
+	}
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name    string
+		input   string
+		want    Query
+		wantErr string
+	}{
+		{
+			name:  "terms",
+			input: "bitcoin  libertad",
+			want:  Query{Terms: []string{"bitcoin", "libertad"}},
+		},
+		{
+			name:  "AND is optional",
+			input: "bitcoin AND libertad",
+			want:  Query{Terms: []string{"bitcoin", "libertad"}},
+		},
+		{
+			name:  "phrase",
+			input: `"banco   central" euro`,
+			want:  Query{Terms: []string{"euro"}, Phrases: []string{"banco central"}},
+		},
+		{
+			name:  "one-word phrase is a term",
+			input: `"bitcoin"`,
+			want:  Query{Terms: []string{"bitcoin"}},
+		},
+		{
+			name:  "OR group",
+			input: "bitcoin OR monero OR zcash",
+			want:  Query{Either: [][]string{{"bitcoin", "monero", "zcash"}}},
+		},
+		{
+			name:  "OR with phrase and separate term",
+			input: `hayek OR "escuela austriaca" inflación`,
+			want:  Query{Terms: []string{"inflación"}, Either: [][]string{{"hayek", "escuela austriaca"}}},
+		},
+		{
+			name:  "lowercase or is a word",
+			input: "bitcoin or monero",
+			want:  Query{Terms: []string{"bitcoin", "or", "monero"}},
+		},
+		{
+			name:  "leading OR",
+			input: "OR bitcoin",
+			want:  Query{Terms: []string{"bitcoin"}},
+		},
+		{
+			name:  "exclude",
+			input: `bitcoin -estafa -"banco central"`,
+			want:  Query{Terms: []string{"bitcoin"}, Exclude: []string{"estafa", "banco central"}},
+		},
+		{
+			name:  "exclude only",
+			input: "-bitcoin",
+			want:  Query{Exclude: []string{"bitcoin"}},
+		},
+		{
+			name:  "source",
+			input: "source:reddit",
+			want:  Query{Sources: []string{"reddit"}},
+		},
+		{
+			name:  "quoted source",
+			input: `SOURCE:"Mises   Institute" hayek`,
+			want:  Query{Terms: []string{"hayek"}, Sources: []string{"Mises Institute"}},
+		},
+		{
+			name:  "empty source is ignored",
+			input: `source: source:"" bitcoin`,
+			want:  Query{Terms: []string{"bitcoin"}},
+		},
+		{
+			name:  "unknown operator is a word",
+			input: "http://example.com",
+			want:  Query{Terms: []string{"http://example.com"}},
+		},
+		{
+			name:  "dates",
+			input: "after:2024-01-02 before:2024-02-01",
+			want: Query{
+				After:  time.Date(2024, 1, 2, 0, 0, 0, 0, cet),
+				Before: time.Date(2024, 2, 1, 0, 0, 0, 0, cet),
+			},
+		},
+		{
+			name:    "bad date keeps the rest",
+			input:   "bitcoin after:2024-13-01 before:ayer",
+			want:    Query{Terms: []string{"bitcoin"}},
+			wantErr: "invalid after date \"2024-13-01\"\ninvalid before date \"ayer\"",
+		},
+		{
+			name:  "unbalanced quote reads to the end",
+			input: `bitcoin "banco central`,
+			want:  Query{Terms: []string{"bitcoin"}, Phrases: []string{"banco central"}},
+		},
+		{
+			name:  "unbalanced quoted source",
+			input: `source:"Mises Institute`,
+			want:  Query{Sources: []string{"Mises Institute"}},
+		},
+		{
+			name:  "lone quote",
+			input: `"`,
+			want:  Query{},
+		},
+		{
+			name:  "empty",
+			input: "   ",
+			want:  Query{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuery(tt.input, cet)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("ParseQuery(%q) error = %q, want %q", tt.input, gotErr, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIsEmpty(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"", true},
+		{`""`, true},
+		{"AND OR", true},
+		{"bitcoin", false},
+		{"-bitcoin", false},
+		{"source:reddit", false},
+		{"before:2024-01-01", false},
+	}
+	for _, tt := range tests {
+		q, _ := ParseQuery(tt.input, time.UTC)
+		if got := q.IsEmpty(); got != tt.want {
+			t.Errorf("ParseQuery(%q).IsEmpty() = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Package search mantiene el índice de texto completo (Bleve) de los
+// artículos descargados, su contenido extraído y los guardados en
+// SAVED/LOVED, y resuelve las búsquedas de /api/search.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Tipos de documento del índice
+const (
+	TypeArticle = "article" // Artículo de un feed, visible para sus suscriptores
+	TypeSaved   = "saved"   // Artículo en SAVED/LOVED de Owner
+)
+
+// Document es lo que se indexa de cada artículo. Title, Summary, Content y
+// Source se analizan como texto; el resto se guarda tal cual para filtrar.
+type Document struct {
+	Type      string    `json:"type"`
+	FeedURL   string    `json:"feed_url"`
+	Owner     string    `json:"owner"`
+	Link      string    `json:"link"`
+	Title     string    `json:"title"`
+	Source    string    `json:"source"`
+	Summary   string    `json:"summary"` // Descripción del feed, en texto plano
+	Content   string    `json:"content"` // Contenido extraído, en texto plano
+	Published time.Time `json:"published"`
+}
+
+// Scope limita una búsqueda a lo que puede ver un usuario: los artículos de
+// sus feeds y sus propios guardados.
+type Scope struct {
+	Owner    string
+	FeedURLs []string
+	// Nombre con el que el usuario ve cada feed (URL -> nombre). source:
+	// busca los artículos de estos feeds por este nombre y no por la fuente
+	// indexada al descargarlos, que no conoce los nombres personalizados.
+	FeedNames map[string]string
+	// Si no está vacío, sólo se buscan estos documentos (p. ej. los del río)
+	IDs []string
+}
+
+// Hit es un resultado de búsqueda. Snippet es HTML con los términos
+// encontrados dentro de <mark>.
+type Hit struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	FeedURL   string    `json:"feed_url,omitempty"`
+	Link      string    `json:"link"`
+	Title     string    `json:"title"`
+	Source    string    `json:"source"`
+	Published time.Time `json:"published"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"`
+}
+
+// Results es una página de resultados, ordenados por relevancia
+type Results struct {
+	Total uint64 `json:"total"`
+	Hits  []Hit  `json:"results"`
+}
+
+// Index envuelve el índice Bleve en disco
+type Index struct {
+	idx bleve.Index
+}
+
+// Open abre el índice de path o lo crea si no existe; created indica que
+// es nuevo y hay que llenarlo.
+func Open(path string) (index *Index, created bool, err error) {
+	idx, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		idx, err = bleve.New(path, newMapping())
+		created = true
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &Index{idx: idx}, created, nil
+}
+
+// Remove borra el índice de path, para reconstruirlo desde cero
+func Remove(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (i *Index) Close() error {
+	return i.idx.Close()
+}
+
+func newMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = standard.Name
+	exact := bleve.NewKeywordFieldMapping()
+	exact.Analyzer = keyword.Name
+	date := bleve.NewDateTimeFieldMapping()
+
+	doc := bleve.NewDocumentStaticMapping()
+	for _, field := range []string{"title", "source", "summary", "content"} {
+		doc.AddFieldMappingsAt(field, text)
+	}
+	for _, field := range []string{"type", "feed_url", "owner", "link"} {
+		doc.AddFieldMappingsAt(field, exact)
+	}
+	doc.AddFieldMappingsAt("published", date)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	m.DefaultAnalyzer = standard.Name
+	return m
+}
+
+// Index añade o reemplaza documentos (id -> documento) en un solo lote
+func (i *Index) Index(docs map[string]Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	batch := i.idx.NewBatch()
+	for id, doc := range docs {
+		if err := batch.Index(id, doc); err != nil {
+			return err
+		}
+	}
+	return i.idx.Batch(batch)
+}
+
+// SetContent guarda content (texto plano) en todos los documentos de link.
+// Devuelve cuántos se actualizaron.
+func (i *Index) SetContent(link, content string) (int, error) {
+	q := bleve.NewTermQuery(link)
+	q.SetField("link")
+	req := bleve.NewSearchRequestOptions(q, 1000, 0, false)
+	req.Fields = []string{"*"}
+	res, err := i.idx.Search(req)
+	if err != nil {
+		return 0, err
+	}
+	docs := make(map[string]Document, len(res.Hits))
+	for _, hit := range res.Hits {
+		doc := documentFromFields(hit.Fields)
+		if doc.Content == content {
+			continue
+		}
+		doc.Content = content
+		docs[hit.ID] = doc
+	}
+	return len(docs), i.Index(docs)
+}
+
+// Search busca q dentro de scope y devuelve size resultados desde from
+func (i *Index) Search(q Query, scope Scope, size, from int) (*Results, error) {
+	if q.IsEmpty() {
+		return nil, fmt.Errorf("empty query")
+	}
+	req := bleve.NewSearchRequestOptions(q.bleveQuery(scope), size, from, false)
+	req.Fields = []string{"type", "feed_url", "link", "title", "source", "published"}
+	req.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	res, err := i.idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &Results{Total: res.Total, Hits: make([]Hit, 0, len(res.Hits))}
+	for _, match := range res.Hits {
+		doc := documentFromFields(match.Fields)
+		hit := Hit{
+			ID:        match.ID,
+			Type:      doc.Type,
+			FeedURL:   doc.FeedURL,
+			Link:      doc.Link,
+			Title:     doc.Title,
+			Source:    doc.Source,
+			Published: doc.Published,
+			Score:     match.Score,
+		}
+		// El fragmento más útil es el del contenido; si no, el resumen
+		for _, field := range []string{"content", "summary", "title"} {
+			if fragments := match.Fragments[field]; len(fragments) > 0 {
+				hit.Snippet = fragments[0]
+				break
+			}
+		}
+		results.Hits = append(results.Hits, hit)
+	}
+	return results, nil
+}
+
+// documentFromFields reconstruye un documento a partir de los campos
+// guardados en el índice
+func documentFromFields(fields map[string]interface{}) Document {
+	str := func(name string) string {
+		s, _ := fields[name].(string)
+		return s
+	}
+	doc := Document{
+		Type:    str("type"),
+		FeedURL: str("feed_url"),
+		Owner:   str("owner"),
+		Link:    str("link"),
+		Title:   str("title"),
+		Source:  str("source"),
+		Summary: str("summary"),
+		Content: str("content"),
+	}
+	doc.Published, _ = time.Parse(time.RFC3339Nano, str("published"))
+	return doc
+}
+
+// bleveQuery traduce q a una consulta Bleve restringida a scope
+func (q Query) bleveQuery(scope Scope) query.Query {
+	// Visibilidad: artículos de los feeds del usuario o sus guardados
+	var visible []query.Query
+	if scope.Owner != "" {
+		owner := bleve.NewTermQuery(scope.Owner)
+		owner.SetField("owner")
+		visible = append(visible, owner)
+	}
+	for _, feedURL := range scope.FeedURLs {
+		feed := bleve.NewTermQuery(feedURL)
+		feed.SetField("feed_url")
+		visible = append(visible, feed)
+	}
+
+	must := []query.Query{bleve.NewDisjunctionQuery(visible...)}
+	if len(scope.IDs) > 0 {
+		must = append(must, bleve.NewDocIDQuery(scope.IDs))
+	}
+	for _, term := range q.Terms {
+		must = append(must, anyTextField(term, false))
+	}
+	for _, phrase := range q.Phrases {
+		must = append(must, anyTextField(phrase, true))
+	}
+	for _, group := range q.Either {
+		var alternatives []query.Query
+		for _, text := range group {
+			alternatives = append(alternatives, anyTextField(text, strings.Contains(text, " ")))
+		}
+		must = append(must, bleve.NewDisjunctionQuery(alternatives...))
+	}
+	for _, source := range q.Sources {
+		must = append(must, sourceQuery(source, scope.FeedNames))
+	}
+	if !q.After.IsZero() || !q.Before.IsZero() {
+		inclusive, exclusive := true, false
+		dates := bleve.NewDateRangeInclusiveQuery(q.After, q.Before, &inclusive, &exclusive)
+		dates.SetField("published")
+		must = append(must, dates)
+	}
+
+	boolean := bleve.NewBooleanQuery()
+	boolean.AddMust(must...)
+	for _, term := range q.Exclude {
+		boolean.AddMustNot(anyTextField(term, strings.Contains(term, " ")))
+	}
+	return boolean
+}
+
+// sourceQuery filtra por la fuente. Los artículos de los feeds de
+// feedNames se buscan por el nombre que les da el usuario (todas las
+// palabras de source en el nombre); los guardados y los demás artículos,
+// por la fuente indexada.
+func sourceQuery(source string, feedNames map[string]string) query.Query {
+	match := bleve.NewMatchQuery(source)
+	match.SetField("source")
+	match.SetOperator(query.MatchQueryOperatorAnd)
+	if len(feedNames) == 0 {
+		return match
+	}
+
+	indexed := bleve.NewBooleanQuery()
+	indexed.AddMust(match)
+	var named []query.Query
+	words := analyze(source)
+	for feedURL, name := range feedNames {
+		feed := bleve.NewTermQuery(feedURL)
+		feed.SetField("feed_url")
+		indexed.AddMustNot(feed)
+		if len(words) > 0 && containsAll(analyze(name), words) {
+			named = append(named, feed)
+		}
+	}
+	return bleve.NewDisjunctionQuery(append(named, indexed)...)
+}
+
+// Analizador de los campos de texto, para comparar nombres de fuente igual
+// que los compara el índice
+var textAnalyzer = newMapping().AnalyzerNamed(standard.Name)
+
+func analyze(text string) []string {
+	var words []string
+	for _, token := range textAnalyzer.Analyze([]byte(text)) {
+		words = append(words, string(token.Term))
+	}
+	return words
+}
+
+func containsAll(words, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(words, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Peso de cada campo de texto: coincidir en el título cuenta más
+var textFields = []struct {
+	name  string
+	boost float64
+}{
+	{"title", 3},
+	{"source", 1.5},
+	{"summary", 1.5},
+	{"content", 1},
+}
+
+func anyTextField(text string, phrase bool) query.Query {
+	var fields []query.Query
+	for _, field := range textFields {
+		if phrase {
+			q := bleve.NewMatchPhraseQuery(text)
+			q.SetField(field.name)
+			q.SetBoost(field.boost)
+			fields = append(fields, q)
+			continue
+		}
+		q := bleve.NewMatchQuery(text)
+		q.SetField(field.name)
+		q.SetBoost(field.boost)
+		fields = append(fields, q)
+	}
+	return bleve.NewDisjunctionQuery(fields...)
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSearchSourceUsesFeedNames(t *testing.T) {
+	index, created, err := Open(filepath.Join(t.TempDir(), "search.bleve"))
+	if err != nil || !created {
+		t.Fatalf("Open() = %v, %v", created, err)
+	}
+	defer index.Close()
+
+	const cnn, mises, reddit = "https://cnn.com/rss", "https://mises.org/feed", "https://reddit.com/r/x.rss"
+	err = index.Index(map[string]Document{
+		"article:1": {Type: TypeArticle, FeedURL: cnn, Link: "https://cnn.com/1", Title: "Bolsa", Source: "CNN - Top Stories"},
+		"article:2": {Type: TypeArticle, FeedURL: mises, Link: "https://mises.org/2", Title: "Precios", Source: "Mises Wire"},
+		"article:3": {Type: TypeArticle, FeedURL: reddit, Link: "https://reddit.com/3", Title: "Hilo", Source: "Reddit"},
+		"saved:ana:4": {Type: TypeSaved, Owner: "ana", Link: "https://example.com/4", Title: "Guardado", Source: "Noticias del mundo",
+			Published: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ana llamó "Noticias del mundo" al feed de CNN; el de Reddit no tiene
+	// nombre ni título, así que se busca por la fuente indexada
+	scope := Scope{
+		Owner:     "ana",
+		FeedURLs:  []string{cnn, mises, reddit},
+		FeedNames: map[string]string{cnn: "Noticias del mundo", mises: "Mises Wire"},
+	}
+	tests := []struct {
+		query string
+		scope Scope
+		want  []string
+	}{
+		{"source:noticias", scope, []string{"article:1", "saved:ana:4"}},
+		{`source:"noticias mundo"`, scope, []string{"article:1", "saved:ana:4"}},
+		{"source:cnn", scope, nil},
+		{"source:mises", scope, []string{"article:2"}},
+		{"source:reddit", scope, []string{"article:3"}},
+		{"source:noticias source:mises", scope, nil},
+		{"source:noticias -guardado", scope, []string{"article:1"}},
+		{"source:cnn", Scope{Owner: "ana", FeedURLs: scope.FeedURLs}, []string{"article:1"}},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := index.Search(q, tt.scope, 10, 0)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, hit := range results.Hits {
+			got = append(got, hit.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ancap-web/internal/storage"
+)
+
+// gitHubReleases resuelve un repositorio ("github.com/dueño/repo") al feed
+// Atom de sus releases.
+type gitHubReleases struct{}
+
+func (gitHubReleases) Name() string { return "github" }
+
+func (gitHubReleases) Resolve(_ context.Context, _ *http.Client, input string) (string, bool, error) {
+	u := parseInputURL(input)
+	if u == nil || strings.ToLower(u.Hostname()) != "github.com" {
+		return "", false, nil
+	}
+	parts := pathParts(u)
+	if len(parts) < 2 {
+		return "", false, nil
+	}
+	if strings.HasSuffix(u.Path, ".atom") {
+		return u.String(), true, nil
+	}
+	repo := strings.TrimSuffix(parts[1], ".git")
+	return "https://github.com/" + parts[0] + "/" + repo + "/releases.atom", true, nil
+}
+
+func (gitHubReleases) Match(feedURL string) bool {
+	u, err := url.Parse(feedURL)
+	if err != nil || strings.ToLower(u.Hostname()) != "github.com" {
+		return false
+	}
+	parts := pathParts(u)
+	return len(parts) == 3 && (parts[2] == "releases.atom" || parts[2] == "tags.atom")
+}
+
+func (gitHubReleases) SourceName(feedURL string, feed *gofeed.Feed) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return strings.TrimSpace(feed.Title)
+	}
+	parts := pathParts(u)
+	if len(parts) < 2 {
+		return strings.TrimSpace(feed.Title)
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// Enrich antepone el repositorio al título: los títulos de release suelen
+// ser sólo la versión ("v1.2.3").
+func (g gitHubReleases) Enrich(item *gofeed.Item, article *storage.Article) {
+	if repo := g.SourceName(article.FeedURL, &gofeed.Feed{}); repo != "" && !strings.Contains(article.Title, repo) {
+		article.Title = repo + " " + article.Title
+	}
+}
@@ -0,0 +1,78 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ancap-web/internal/storage"
+)
+
+// mastodon resuelve cuentas del fediverso ("@usuario@instancia" o
+// "https://instancia/@usuario") al feed RSS público de la cuenta.
+type mastodon struct{}
+
+var (
+	mastodonAccount = regexp.MustCompile(`^@?([\w.-]+)@([\w-]+(?:\.[\w-]+)+)$`)
+	htmlTags        = regexp.MustCompile(`<[^>]*>`)
+)
+
+func (mastodon) Name() string { return "mastodon" }
+
+func (mastodon) Resolve(_ context.Context, _ *http.Client, input string) (string, bool, error) {
+	if m := mastodonAccount.FindStringSubmatch(input); m != nil {
+		return "https://" + strings.ToLower(m[2]) + "/@" + m[1] + ".rss", true, nil
+	}
+	u := parseInputURL(input)
+	if u == nil {
+		return "", false, nil
+	}
+	parts := pathParts(u)
+	if len(parts) != 1 || !strings.HasPrefix(parts[0], "@") || len(parts[0]) < 2 || strings.Contains(parts[0][1:], "@") {
+		return "", false, nil
+	}
+	// Sólo se reconoce el formato de Mastodon: https://instancia/@usuario
+	if strings.HasSuffix(parts[0], ".rss") || hostIs(u, "youtube.com") || hostIs(u, "medium.com") {
+		return "", false, nil
+	}
+	return u.Scheme + "://" + u.Host + "/" + parts[0] + ".rss", true, nil
+}
+
+func (mastodon) Match(feedURL string) bool {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return false
+	}
+	parts := pathParts(u)
+	return len(parts) == 1 && strings.HasPrefix(parts[0], "@") && strings.HasSuffix(parts[0], ".rss")
+}
+
+func (mastodon) SourceName(feedURL string, feed *gofeed.Feed) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return strings.TrimSpace(feed.Title)
+	}
+	user := strings.TrimSuffix(pathParts(u)[0], ".rss")
+	return user + "@" + u.Hostname()
+}
+
+// Enrich da título a las publicaciones, que en Mastodon no lo tienen, y
+// toma la primera imagen adjunta.
+func (mastodon) Enrich(item *gofeed.Item, article *storage.Article) {
+	if strings.TrimSpace(article.Title) == "" {
+		text := htmlTags.ReplaceAllString(article.Description, " ")
+		article.Title = shorten(strings.Join(strings.Fields(text), " "), 120)
+	}
+	if article.ImageURL == "" {
+		for _, content := range item.Extensions["media"]["content"] {
+			if content.Attrs["medium"] == "image" && content.Attrs["url"] != "" {
+				article.ImageURL = content.Attrs["url"]
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package sources
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ancap-web/internal/storage"
+)
+
+// reddit resuelve subreddits ("r/golang") y usuarios ("u/nombre") a su feed RSS.
+type reddit struct{}
+
+var (
+	redditShortName = regexp.MustCompile(`^/?(r|u|user)/([\w-]+)/?$`)
+	// Reddit pone el enlace externo del post como "[link]" en el contenido
+	redditExternalLink = regexp.MustCompile(`<a href="([^"]+)">\[link\]</a>`)
+)
+
+func (reddit) Name() string { return "reddit" }
+
+func (reddit) Resolve(_ context.Context, _ *http.Client, input string) (string, bool, error) {
+	if m := redditShortName.FindStringSubmatch(input); m != nil {
+		return redditFeedURL(m[1], m[2]), true, nil
+	}
+	u := parseInputURL(input)
+	if u == nil || !hostIs(u, "reddit.com") {
+		return "", false, nil
+	}
+	parts := pathParts(u)
+	if len(parts) < 2 || (parts[0] != "r" && parts[0] != "u" && parts[0] != "user") {
+		return "", false, nil
+	}
+	if strings.HasSuffix(u.Path, ".rss") {
+		return u.String(), true, nil
+	}
+	return redditFeedURL(parts[0], parts[1]), true, nil
+}
+
+func redditFeedURL(kind, name string) string {
+	if kind == "u" {
+		kind = "user"
+	}
+	return "https://www.reddit.com/" + kind + "/" + url.PathEscape(name) + "/.rss"
+}
+
+func (reddit) Match(feedURL string) bool {
+	u, err := url.Parse(feedURL)
+	return err == nil && hostIs(u, "reddit.com") && strings.HasSuffix(u.Path, ".rss")
+}
+
+func (reddit) SourceName(feedURL string, feed *gofeed.Feed) string {
+	u, err := url.Parse(feedURL)
+	if err == nil {
+		if parts := pathParts(u); len(parts) >= 2 {
+			if parts[0] == "user" {
+				return "u/" + parts[1]
+			}
+			return parts[0] + "/" + parts[1]
+		}
+	}
+	return strings.TrimSpace(feed.Title)
+}
+
+// Enrich usa la miniatura del post y, si es un enlace externo, lo deja en
+// la descripción para poder abrirlo sin pasar por Reddit.
+func (reddit) Enrich(item *gofeed.Item, article *storage.Article) {
+	if thumb := mediaAttr(item, "thumbnail", "url"); thumb != "" {
+		article.ImageURL = thumb
+	}
+	if m := redditExternalLink.FindStringSubmatch(item.Content); m != nil && !strings.Contains(m[1], "reddit.com") {
+		// El enlace viene de un atributo HTML: se desescapa para validarlo y
+		// se vuelve a escapar al insertarlo
+		link := html.UnescapeString(m[1])
+		if u, err := url.Parse(link); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			link = html.EscapeString(link)
+			article.Description = `<p><a href="` + link + `">` + link + `</a></p>` + article.Description
+		}
+	}
+}
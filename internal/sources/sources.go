@@ -0,0 +1,240 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+
+	"ancap-web/internal/storage"
+)
+
+// Adapter traduce entradas amigables de un servicio concreto (un @handle de
+// YouTube, un subreddit...) a la URL de su feed y completa los artículos
+// con los datos propios de ese servicio.
+type Adapter interface {
+	// Name identifica al adaptador en logs y respuestas
+	Name() string
+	// Resolve devuelve la URL del feed para input, o ok=false si la entrada
+	// no es de este servicio. Puede hacer peticiones HTTP con client.
+	Resolve(ctx context.Context, client *http.Client, input string) (feedURL string, ok bool, err error)
+	// Match indica si el adaptador se encarga de un feed ya resuelto
+	Match(feedURL string) bool
+	// SourceName es el nombre de la fuente que se muestra con cada artículo
+	SourceName(feedURL string, feed *gofeed.Feed) string
+	// Enrich completa article con los datos de item propios del servicio
+	Enrich(item *gofeed.Item, article *storage.Article)
+}
+
+var adapters []Adapter
+
+// Register añade un adaptador. Se consultan en orden de registro.
+func Register(a Adapter) {
+	adapters = append(adapters, a)
+}
+
+func init() {
+	Register(youTube{})
+	Register(reddit{})
+	Register(mastodon{})
+	Register(gitHubReleases{})
+}
+
+// Resolve pasa input por los adaptadores registrados. Si ninguno lo
+// reconoce devuelve ok=false y el input se trata como una URL normal.
+func Resolve(ctx context.Context, client *http.Client, input string) (string, Adapter, bool, error) {
+	input = strings.TrimSpace(input)
+	for _, a := range adapters {
+		feedURL, ok, err := a.Resolve(ctx, client, input)
+		if err != nil {
+			return "", a, true, err
+		}
+		if ok {
+			return feedURL, a, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
+
+// ForFeed devuelve el adaptador que se encarga de feedURL, o nil
+func ForFeed(feedURL string) Adapter {
+	for _, a := range adapters {
+		if a.Match(feedURL) {
+			return a
+		}
+	}
+	return nil
+}
+
+// Enrich aplica a cualquier item los datos genéricos (imagen, miniatura,
+// duración y adjuntos de Media RSS o iTunes) y después los del adaptador,
+// si lo hay.
+func Enrich(a Adapter, item *gofeed.Item, article *storage.Article) {
+	if item.Image != nil && item.Image.URL != "" {
+		article.ImageURL = item.Image.URL
+	}
+	if thumb := mediaAttr(item, "thumbnail", "url"); thumb != "" && article.ImageURL == "" {
+		article.ImageURL = thumb
+	}
+	if d := mediaAttr(item, "content", "duration"); d != "" {
+		article.Duration, _ = strconv.Atoi(d)
+	}
+	if item.ITunesExt != nil && item.ITunesExt.Duration != "" && article.Duration == 0 {
+		article.Duration = ParseDuration(item.ITunesExt.Duration)
+	}
+	if article.ImageURL == "" && item.ITunesExt != nil && item.ITunesExt.Image != "" {
+		article.ImageURL = item.ITunesExt.Image
+	}
+	article.Enclosures = enclosures(item, article.Duration)
+	if a != nil {
+		a.Enrich(item, article)
+	}
+}
+
+// enclosures reúne los adjuntos del item: los <enclosure> de RSS (o links
+// rel="enclosure" de Atom) y los media:content de audio o vídeo. El primero
+// reproducible se queda con la duración del episodio.
+func enclosures(item *gofeed.Item, duration int) []storage.Enclosure {
+	var list []storage.Enclosure
+	seen := make(map[string]bool)
+	add := func(e storage.Enclosure) {
+		if e.URL == "" || seen[e.URL] {
+			return
+		}
+		seen[e.URL] = true
+		list = append(list, e)
+	}
+	for _, enc := range item.Enclosures {
+		if enc == nil {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enc.Length), 10, 64)
+		add(storage.Enclosure{URL: strings.TrimSpace(enc.URL), Type: enc.Type, Length: length})
+	}
+	for _, content := range item.Extensions["media"]["content"] {
+		e := storage.Enclosure{URL: content.Attrs["url"], Type: content.Attrs["type"]}
+		if medium := content.Attrs["medium"]; e.Type == "" && (medium == "audio" || medium == "video") {
+			e.Type = medium + "/*"
+		}
+		if e.Kind() == "" {
+			continue
+		}
+		e.Length, _ = strconv.ParseInt(content.Attrs["fileSize"], 10, 64)
+		e.Duration, _ = strconv.Atoi(content.Attrs["duration"])
+		add(e)
+	}
+	for i := range list {
+		if list[i].Kind() != "" {
+			if list[i].Duration == 0 {
+				list[i].Duration = duration
+			}
+			break
+		}
+	}
+	return list
+}
+
+// ParseDuration interpreta las duraciones de iTunes: segundos ("754"),
+// "MM:SS" o "HH:MM:SS". Devuelve 0 si no se entiende.
+func ParseDuration(value string) int {
+	total := 0
+	for _, part := range strings.Split(strings.TrimSpace(value), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return total
+}
+
+// mediaAttr busca el atributo attr del elemento media:name, directamente en
+// el item o dentro de media:group (como hace YouTube).
+func mediaAttr(item *gofeed.Item, name, attr string) string {
+	media := item.Extensions["media"]
+	if media == nil {
+		return ""
+	}
+	if v := firstAttr(media[name], attr); v != "" {
+		return v
+	}
+	for _, group := range media["group"] {
+		if v := firstAttr(group.Children[name], attr); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// mediaValue es como mediaAttr pero devuelve el texto del elemento
+func mediaValue(item *gofeed.Item, name string) string {
+	media := item.Extensions["media"]
+	if media == nil {
+		return ""
+	}
+	for _, e := range media[name] {
+		if e.Value != "" {
+			return e.Value
+		}
+	}
+	for _, group := range media["group"] {
+		for _, e := range group.Children[name] {
+			if e.Value != "" {
+				return e.Value
+			}
+		}
+	}
+	return ""
+}
+
+func firstAttr(elements []ext.Extension, attr string) string {
+	for _, e := range elements {
+		if v := e.Attrs[attr]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseInputURL interpreta input como URL, añadiendo https:// si no tiene
+// esquema. Devuelve nil si no parece una URL.
+func parseInputURL(input string) *url.URL {
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" || !strings.Contains(u.Host, ".") {
+		return nil
+	}
+	return u
+}
+
+// hostIs compara el host de u con domain, aceptando subdominios (www., m.)
+func hostIs(u *url.URL, domain string) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// pathParts devuelve los segmentos no vacíos de la ruta
+func pathParts(u *url.URL) []string {
+	var parts []string
+	for _, p := range strings.Split(u.Path, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// shorten corta s a max runas añadiendo "..."
+func shorten(s string, max int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:max-3])) + "..."
+}
@@ -0,0 +1,297 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	"ancap-web/internal/storage"
+)
+
+const channelID = "UCabcdefghijklmnopqrstuv"
+
+// testClient manda todas las peticiones al servidor de prueba, sea cual sea
+// el host, y apunta las URLs pedidas
+func testClient(t *testing.T, handler http.HandlerFunc) (*http.Client, *[]string) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	var requested []string
+	client := server.Client()
+	transport := client.Transport
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return transport.RoundTrip(req)
+	})
+	return client, &requested
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestResolve(t *testing.T) {
+	client, requested := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "CONSENT=YES+1" {
+			http.Error(w, "consent", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/@mises":
+			w.Write([]byte(`<html><head><link rel="canonical" href="https://www.youtube.com/channel/` + channelID + `"></head></html>`))
+		case "/c/Hayek":
+			w.Write([]byte(`<script>var data = {"externalId":"` + channelID + `"};</script>`))
+		case "/@sinid":
+			w.Write([]byte(`<html>nada</html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	channelFeed := youTubeFeedBase + "?channel_id=" + channelID
+	tests := []struct {
+		input       string
+		wantURL     string
+		wantAdapter string
+		wantErr     bool
+		wantFetch   string
+	}{
+		// YouTube
+		{input: "@mises", wantURL: channelFeed, wantAdapter: "youtube", wantFetch: "https://www.youtube.com/@mises"},
+		{input: "https://www.youtube.com/@mises/videos", wantURL: channelFeed, wantAdapter: "youtube", wantFetch: "https://www.youtube.com/@mises"},
+		{input: "youtube.com/c/Hayek", wantURL: channelFeed, wantAdapter: "youtube", wantFetch: "https://www.youtube.com/c/Hayek"},
+		{input: "https://www.youtube.com/channel/" + channelID, wantURL: channelFeed, wantAdapter: "youtube"},
+		{input: "https://m.youtube.com/channel/" + channelID + "/featured", wantURL: channelFeed, wantAdapter: "youtube"},
+		{input: "https://www.youtube.com/user/misesmedia", wantURL: youTubeFeedBase + "?user=misesmedia", wantAdapter: "youtube"},
+		{input: "https://www.youtube.com/playlist?list=PL123", wantURL: youTubeFeedBase + "?playlist_id=PL123", wantAdapter: "youtube"},
+		{input: channelFeed, wantURL: channelFeed, wantAdapter: "youtube"},
+		{input: "@sinid", wantAdapter: "youtube", wantErr: true, wantFetch: "https://www.youtube.com/@sinid"},
+		{input: "https://www.youtube.com/@noexiste", wantAdapter: "youtube", wantErr: true, wantFetch: "https://www.youtube.com/@noexiste"},
+		// Reddit
+		{input: "r/golang", wantURL: "https://www.reddit.com/r/golang/.rss", wantAdapter: "reddit"},
+		{input: "/u/spez/", wantURL: "https://www.reddit.com/user/spez/.rss", wantAdapter: "reddit"},
+		{input: "https://old.reddit.com/r/Economics/comments/abc/titulo/", wantURL: "https://www.reddit.com/r/Economics/.rss", wantAdapter: "reddit"},
+		{input: "https://www.reddit.com/r/golang/top/.rss?t=week", wantURL: "https://www.reddit.com/r/golang/top/.rss?t=week", wantAdapter: "reddit"},
+		// Mastodon
+		{input: "@Gargron@Mastodon.Social", wantURL: "https://mastodon.social/@Gargron.rss", wantAdapter: "mastodon"},
+		{input: "gargron@mastodon.social", wantURL: "https://mastodon.social/@gargron.rss", wantAdapter: "mastodon"},
+		{input: "https://fosstodon.org/@golang", wantURL: "https://fosstodon.org/@golang.rss", wantAdapter: "mastodon"},
+		{input: "https://medium.com/@autor", wantAdapter: ""},
+		// GitHub
+		{input: "github.com/golang/go", wantURL: "https://github.com/golang/go/releases.atom", wantAdapter: "github"},
+		{input: "https://github.com/golang/go.git", wantURL: "https://github.com/golang/go/releases.atom", wantAdapter: "github"},
+		{input: "https://github.com/golang/go/tree/master/src", wantURL: "https://github.com/golang/go/releases.atom", wantAdapter: "github"},
+		{input: "https://github.com/golang/go/tags.atom", wantURL: "https://github.com/golang/go/tags.atom", wantAdapter: "github"},
+		{input: "https://github.com/golang", wantAdapter: ""},
+		// Lo demás se trata como una URL normal
+		{input: "https://mises.org/feed", wantAdapter: ""},
+		{input: "  ", wantAdapter: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			*requested = nil
+			feedURL, adapter, ok, err := Resolve(context.Background(), client, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			name := ""
+			if adapter != nil {
+				name = adapter.Name()
+			}
+			if name != tt.wantAdapter || ok != (tt.wantAdapter != "") {
+				t.Errorf("Resolve() adapter = %q, ok = %v, want %q", name, ok, tt.wantAdapter)
+			}
+			if feedURL != tt.wantURL {
+				t.Errorf("Resolve() = %q, want %q", feedURL, tt.wantURL)
+			}
+			var wantFetched []string
+			if tt.wantFetch != "" {
+				wantFetched = []string{tt.wantFetch}
+			}
+			if !reflect.DeepEqual(*requested, wantFetched) {
+				t.Errorf("requests = %v, want %v", *requested, wantFetched)
+			}
+		})
+	}
+}
+
+func parseItem(t *testing.T, feed string) *gofeed.Item {
+	t.Helper()
+	parsed, err := gofeed.NewParser().ParseString(feed)
+	if err != nil {
+		t.Fatalf("ParseString: %v", err)
+	}
+	if len(parsed.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(parsed.Items))
+	}
+	return parsed.Items[0]
+}
+
+func rss(item string) string {
+	return `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel><title>Feed</title>` + item + `</channel></rss>`
+}
+
+func TestEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		feedURL string
+		feed    string
+		article storage.Article // Lo que ya trae el artículo antes de Enrich
+		want    storage.Article
+	}{
+		{
+			name:    "podcast with itunes duration",
+			feedURL: "https://example.com/podcast.xml",
+			feed: rss(`<item><title>Episodio 1</title>
+				<enclosure url="https://example.com/1.mp3" type="audio/mpeg" length=" 1234 "/>
+				<itunes:duration>1:02:03</itunes:duration>
+				<itunes:image href="https://example.com/ep1.jpg"/></item>`),
+			want: storage.Article{
+				ImageURL:   "https://example.com/ep1.jpg",
+				Duration:   3723,
+				Enclosures: []storage.Enclosure{{URL: "https://example.com/1.mp3", Type: "audio/mpeg", Length: 1234, Duration: 3723}},
+			},
+		},
+		{
+			name:    "media content video; images are not enclosures",
+			feedURL: "https://example.com/videos.xml",
+			feed: rss(`<item><title>Vídeo</title>
+				<media:content url="https://example.com/v.mp4" medium="video" duration="90" fileSize="2048"/>
+				<media:content url="https://example.com/foto.jpg" medium="image"/>
+				<media:thumbnail url="https://example.com/thumb.jpg"/></item>`),
+			want: storage.Article{
+				ImageURL:   "https://example.com/foto.jpg",
+				Duration:   90,
+				Enclosures: []storage.Enclosure{{URL: "https://example.com/v.mp4", Type: "video/*", Length: 2048, Duration: 90}},
+			},
+		},
+		{
+			name:    "youtube",
+			feedURL: youTubeFeedBase + "?channel_id=" + channelID,
+			feed: `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+<title>Mises Institute</title>
+<entry><title>Conferencia</title><link href="https://www.youtube.com/watch?v=abc"/>
+<media:group>
+	<media:thumbnail url="https://i.ytimg.com/vi/abc/hqdefault.jpg" width="480" height="360"/>
+	<media:description>Primera línea &amp; más
+Segunda</media:description>
+</media:group></entry></feed>`,
+			want: storage.Article{
+				ImageURL:    "https://i.ytimg.com/vi/abc/hqdefault.jpg",
+				Description: "Primera línea &amp; más<br>Segunda",
+			},
+		},
+		{
+			name:    "reddit external link",
+			feedURL: "https://www.reddit.com/r/Economics/.rss",
+			feed: `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+<title>Economics</title>
+<entry><title>Post</title><link href="https://www.reddit.com/r/Economics/comments/1/post/"/>
+<content type="html">enviado por u/x &lt;a href="https://mises.org/a?b=1&amp;amp;c=2"&gt;[link]&lt;/a&gt; &lt;a href="https://www.reddit.com/r/x/comments/1"&gt;[comments]&lt;/a&gt;</content>
+<media:thumbnail url="https://b.thumbs.redditmedia.com/t.jpg"/></entry></feed>`,
+			article: storage.Article{Description: "<p>resumen</p>"},
+			want: storage.Article{
+				ImageURL:    "https://b.thumbs.redditmedia.com/t.jpg",
+				Description: `<p><a href="https://mises.org/a?b=1&amp;c=2">https://mises.org/a?b=1&amp;c=2</a></p><p>resumen</p>`,
+			},
+		},
+		{
+			name:    "reddit self post and javascript links are not added",
+			feedURL: "https://www.reddit.com/r/Economics/.rss",
+			feed: `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Economics</title>
+<entry><title>Post</title><content type="html">&lt;a href="javascript:alert(1)"&gt;[link]&lt;/a&gt; &lt;a href="https://www.reddit.com/r/x/comments/1"&gt;[link]&lt;/a&gt;</content></entry></feed>`,
+			article: storage.Article{Description: "<p>resumen</p>"},
+			want:    storage.Article{Description: "<p>resumen</p>"},
+		},
+		{
+			name:    "mastodon untitled post",
+			feedURL: "https://mastodon.social/@gargron.rss",
+			feed:    rss(`<item><description>Hola</description><media:content url="https://files.mastodon.social/a.png" medium="image" type="image/png"/></item>`),
+			article: storage.Article{Description: "<p>Hola <b>mundo</b></p>\n<p>otra   línea</p>"},
+			want: storage.Article{
+				Title:       "Hola mundo otra línea",
+				Description: "<p>Hola <b>mundo</b></p>\n<p>otra   línea</p>",
+				ImageURL:    "https://files.mastodon.social/a.png",
+			},
+		},
+		{
+			name:    "github release title",
+			feedURL: "https://github.com/golang/go/releases.atom",
+			feed:    rss(`<item><title>go1.22.0</title></item>`),
+			article: storage.Article{Title: "go1.22.0"},
+			want:    storage.Article{Title: "golang/go go1.22.0"},
+		},
+		{
+			name:    "github title that already names the repo",
+			feedURL: "https://github.com/golang/go/releases.atom",
+			feed:    rss(`<item><title>golang/go 1.22</title></item>`),
+			article: storage.Article{Title: "golang/go 1.22"},
+			want:    storage.Article{Title: "golang/go 1.22"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := parseItem(t, tt.feed)
+			article := tt.article
+			article.FeedURL = tt.feedURL
+			Enrich(ForFeed(tt.feedURL), item, &article)
+			tt.want.FeedURL = tt.feedURL
+			if !reflect.DeepEqual(article, tt.want) {
+				t.Errorf("Enrich() =\n%+v\nwant\n%+v", article, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"754", 754},
+		{"12:34", 754},
+		{" 1:02:03 ", 3723},
+		{"", 0},
+		{"1:xx", 0},
+		{"-5", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseDuration(tt.value); got != tt.want {
+			t.Errorf("ParseDuration(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestForFeed(t *testing.T) {
+	tests := map[string]string{
+		youTubeFeedBase + "?channel_id=" + channelID:   "youtube",
+		"https://www.reddit.com/r/golang/.rss":         "reddit",
+		"https://mastodon.social/@gargron.rss":         "mastodon",
+		"https://github.com/golang/go/releases.atom":   "github",
+		"https://github.com/golang/go/commits.atom":    "",
+		"https://mises.org/feed":                       "",
+		"https://www.youtube.com/watch?v=" + channelID: "",
+	}
+	for feedURL, want := range tests {
+		name := ""
+		if a := ForFeed(feedURL); a != nil {
+			name = a.Name()
+		}
+		if name != want {
+			t.Errorf("ForFeed(%q) = %q, want %q", feedURL, name, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ancap-web/internal/storage"
+)
+
+// youTube resuelve canales (@handle, /channel/UC..., /c/nombre,
+// /user/nombre) y listas de reproducción al feed de vídeos de YouTube.
+type youTube struct{}
+
+const youTubeFeedBase = "https://www.youtube.com/feeds/videos.xml"
+
+var (
+	youTubeChannelID = regexp.MustCompile(`^UC[\w-]{22}$`)
+	// La página de un canal incluye su ID en varios sitios; se prueban en orden
+	youTubeChannelIDInPage = []*regexp.Regexp{
+		regexp.MustCompile(`<link rel="canonical" href="https://www\.youtube\.com/channel/(UC[\w-]{22})"`),
+		regexp.MustCompile(`<meta itemprop="(?:identifier|channelId)" content="(UC[\w-]{22})"`),
+		regexp.MustCompile(`"(?:channelId|externalId)":"(UC[\w-]{22})"`),
+	}
+)
+
+func (youTube) Name() string { return "youtube" }
+
+func (y youTube) Resolve(ctx context.Context, client *http.Client, input string) (string, bool, error) {
+	// "@handle" a secas
+	if strings.HasPrefix(input, "@") && !strings.Contains(input[1:], "@") && !strings.Contains(input, "/") {
+		return y.resolvePage(ctx, client, "https://www.youtube.com/"+input)
+	}
+	u := parseInputURL(input)
+	if u == nil || !(hostIs(u, "youtube.com") || hostIs(u, "youtu.be")) {
+		return "", false, nil
+	}
+	if strings.HasPrefix(u.Path, "/feeds/videos.xml") {
+		return u.String(), true, nil
+	}
+	if list := u.Query().Get("list"); list != "" {
+		return youTubeFeedBase + "?playlist_id=" + url.QueryEscape(list), true, nil
+	}
+
+	parts := pathParts(u)
+	switch {
+	case len(parts) >= 2 && parts[0] == "channel" && youTubeChannelID.MatchString(parts[1]):
+		return youTubeFeedBase + "?channel_id=" + parts[1], true, nil
+	case len(parts) >= 2 && parts[0] == "user":
+		return youTubeFeedBase + "?user=" + url.QueryEscape(parts[1]), true, nil
+	case len(parts) >= 1 && strings.HasPrefix(parts[0], "@"):
+		return y.resolvePage(ctx, client, "https://www.youtube.com/"+parts[0])
+	case len(parts) >= 2 && parts[0] == "c":
+		return y.resolvePage(ctx, client, "https://www.youtube.com/c/"+parts[1])
+	}
+	return "", false, nil
+}
+
+// resolvePage descarga la página del canal para averiguar su channel_id,
+// que los @handle y las URLs /c/ no incluyen.
+func (youTube) resolvePage(ctx context.Context, client *http.Client, pageURL string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", true, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; ancap-web)")
+	// Evitar la página de consentimiento de cookies en la UE
+	req.Header.Set("Cookie", "CONSENT=YES+1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", true, fmt.Errorf("youtube: HTTP %d for %s", resp.StatusCode, pageURL)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", true, err
+	}
+	for _, re := range youTubeChannelIDInPage {
+		if m := re.FindSubmatch(body); m != nil {
+			return youTubeFeedBase + "?channel_id=" + string(m[1]), true, nil
+		}
+	}
+	return "", true, fmt.Errorf("youtube: channel id not found in %s", pageURL)
+}
+
+func (youTube) Match(feedURL string) bool {
+	u, err := url.Parse(feedURL)
+	return err == nil && hostIs(u, "youtube.com") && strings.HasPrefix(u.Path, "/feeds/videos.xml")
+}
+
+// SourceName usa el título del canal; los feeds antiguos de usuario se
+// titulan "Uploads by ...", y si no hay título se identifica por la URL.
+func (youTube) SourceName(feedURL string, feed *gofeed.Feed) string {
+	title := strings.TrimSpace(feed.Title)
+	if title != "" && title != "YouTube" && !strings.Contains(strings.ToLower(title), "uploads by") {
+		return title
+	}
+	if feed.Author != nil && feed.Author.Name != "" {
+		return feed.Author.Name
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return "YouTube Channel"
+	}
+	q := u.Query()
+	switch {
+	case q.Get("user") != "":
+		return "YouTube @" + q.Get("user")
+	case q.Get("channel_id") != "":
+		return "YT " + shorten(q.Get("channel_id"), 12)
+	case q.Get("playlist_id") != "":
+		return "YT playlist"
+	}
+	return "YouTube Channel"
+}
+
+// Enrich toma la miniatura y la descripción de media:group; YouTube deja
+// vacía la descripción normal del item.
+func (youTube) Enrich(item *gofeed.Item, article *storage.Article) {
+	if thumb := mediaAttr(item, "thumbnail", "url"); thumb != "" {
+		article.ImageURL = thumb
+	}
+	if article.Description == "" {
+		if desc := mediaValue(item, "description"); desc != "" {
+			article.Description = strings.ReplaceAll(html.EscapeString(desc), "\n", "<br>")
+		}
+	}
+}
@@ -0,0 +1,1240 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketUsers        = []byte("users")
+	bucketFeeds        = []byte("feeds")
+	bucketSessions     = []byte("sessions")
+	bucketLists        = []byte("lists")
+	bucketArticleState = []byte("article_state")
+	bucketFavorites    = []byte("favorites")
+	bucketMeta         = []byte("meta")
+	bucketFeedState    = []byte("feed_state")
+	bucketArticles     = []byte("articles")
+	bucketContent      = []byte("content")
+	// Índice LRU de la caché de contenido: clave último acceso + URL,
+	// valor el tamaño de la entrada
+	bucketContentLRU = []byte("content_lru")
+	bucketSnapshots  = []byte("snapshots")
+	bucketImages     = []byte("snapshot_images")
+	bucketAttempts   = []byte("snapshot_attempts")
+	bucketSmartFeeds = []byte("smart_feeds")
+	// Token del RSS de cada smart feed -> usuario + 0 + ID
+	bucketSmartTokens = []byte("smart_feed_tokens")
+	bucketRules       = []byte("rules")
+)
+
+// Total de bytes de la caché de contenido, en el bucket meta
+var metaContentBytes = []byte("content_bytes")
+
+// defaultOwner sustituye al usuario vacío (el antiguo feeds.json compartido),
+// ya que bbolt no admite claves vacías.
+const defaultOwner = "_default"
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketUsers, bucketFeeds, bucketSessions, bucketLists, bucketArticleState, bucketFavorites, bucketMeta, bucketFeedState, bucketArticles, bucketContent, bucketContentLRU, bucketSnapshots, bucketImages, bucketAttempts, bucketSmartFeeds, bucketSmartTokens, bucketRules} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// El antiguo conjunto de artículos "cargados" se sustituyó por el
+		// estado leído/no leído
+		if err := tx.DeleteBucket([]byte("loaded")); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func ownerKey(username string) []byte {
+	if username == "" {
+		return []byte(defaultOwner)
+	}
+	return []byte(username)
+}
+
+func seqKey(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// ==========================
+// Usuarios
+// ==========================
+
+func (s *BoltStore) GetUser(username string) (*User, error) {
+	var user User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketUsers).Get([]byte(username))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *BoltStore) ListUsers() ([]User, error) {
+	var users []User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEach(func(_, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+func (s *BoltStore) CreateUser(user User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUsers)
+		if b.Get([]byte(user.Username)) != nil {
+			return ErrExists
+		}
+		return putJSON(b, []byte(user.Username), user)
+	})
+}
+
+func (s *BoltStore) UpdateUser(username string, fn func(*User) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUsers)
+		data := b.Get([]byte(username))
+		if data == nil {
+			return ErrNotFound
+		}
+		var user User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+		// El nombre es la clave: no se puede cambiar desde aquí
+		user.Username = username
+		return putJSON(b, []byte(username), user)
+	})
+}
+
+// ==========================
+// Feeds
+// ==========================
+
+func getFeeds(tx *bolt.Tx, username string) ([]Feed, error) {
+	data := tx.Bucket(bucketFeeds).Get(ownerKey(username))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var feeds []Feed
+	if err := json.Unmarshal(data, &feeds); err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+func (s *BoltStore) ListFeeds(username string) ([]Feed, error) {
+	var feeds []Feed
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		feeds, err = getFeeds(tx, username)
+		return err
+	})
+	return feeds, err
+}
+
+func (s *BoltStore) AddFeed(username string, feed Feed) (bool, error) {
+	added := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		feeds, err := getFeeds(tx, username)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		for _, f := range feeds {
+			if f.URL == feed.URL {
+				return nil
+			}
+		}
+		added = true
+		return putJSON(tx.Bucket(bucketFeeds), ownerKey(username), append(feeds, feed))
+	})
+	return added, err
+}
+
+func (s *BoltStore) SeedFeeds(username string, feeds []Feed) (bool, error) {
+	if feeds == nil {
+		feeds = []Feed{}
+	}
+	seeded := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketFeeds)
+		if b.Get(ownerKey(username)) != nil {
+			return nil
+		}
+		seeded = true
+		return putJSON(b, ownerKey(username), feeds)
+	})
+	return seeded, err
+}
+
+func (s *BoltStore) SaveFeeds(username string, feeds []Feed) error {
+	if feeds == nil {
+		feeds = []Feed{}
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketFeeds), ownerKey(username), feeds)
+	})
+}
+
+func (s *BoltStore) UpdateFeed(username, url string, fn func(*Feed) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		feeds, err := getFeeds(tx, username)
+		if err != nil {
+			return err
+		}
+		for i := range feeds {
+			if feeds[i].URL != url {
+				continue
+			}
+			if err := fn(&feeds[i]); err != nil {
+				return err
+			}
+			return putJSON(tx.Bucket(bucketFeeds), ownerKey(username), feeds)
+		}
+		return ErrNotFound
+	})
+}
+
+func (s *BoltStore) DeleteFeed(username, url string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		feeds, err := getFeeds(tx, username)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		updated := make([]Feed, 0, len(feeds))
+		for _, f := range feeds {
+			if f.URL == url {
+				found = true
+				continue
+			}
+			updated = append(updated, f)
+		}
+		if !found {
+			return nil
+		}
+		return putJSON(tx.Bucket(bucketFeeds), ownerKey(username), updated)
+	})
+	return found, err
+}
+
+// DistinctFeedURLs devuelve las URLs de los feeds activos de todos los
+// usuarios, sin duplicados.
+func (s *BoltStore) DistinctFeedURLs() ([]string, error) {
+	seen := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFeeds).ForEach(func(_, v []byte) error {
+			var feeds []Feed
+			if err := json.Unmarshal(v, &feeds); err != nil {
+				return nil
+			}
+			for _, f := range feeds {
+				if f.Active && f.URL != "" {
+					seen[f.URL] = true
+				}
+			}
+			return nil
+		})
+	})
+	urls := make([]string, 0, len(seen))
+	for url := range seen {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls, err
+}
+
+func (s *BoltStore) UpdateFeedInfo(url string, info FeedInfo) (int, error) {
+	updated := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketFeeds)
+		// Recoger los cambios antes de escribir: no se debe modificar un
+		// bucket mientras se recorre con ForEach
+		changes := make(map[string][]Feed)
+		b.ForEach(func(owner, v []byte) error {
+			var feeds []Feed
+			if err := json.Unmarshal(v, &feeds); err != nil {
+				return nil
+			}
+			changed := false
+			for i := range feeds {
+				if feeds[i].URL != url {
+					continue
+				}
+				before := feeds[i]
+				feeds[i].SetInfo(info)
+				if feeds[i] != before {
+					changed = true
+					updated++
+				}
+			}
+			if changed {
+				changes[string(owner)] = feeds
+			}
+			return nil
+		})
+		for owner, feeds := range changes {
+			if err := putJSON(b, []byte(owner), feeds); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// ==========================
+// Artículos y estado de descarga
+// ==========================
+
+func (s *BoltStore) GetFeedState(url string) (*FeedState, error) {
+	var state FeedState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketFeedState).Get([]byte(url))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *BoltStore) SaveFeedState(state FeedState) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketFeedState), []byte(state.URL), state)
+	})
+}
+
+// SaveFetchResult guarda el estado y los artículos de un feed en la misma
+// transacción.
+func (s *BoltStore) SaveFetchResult(state FeedState, articles []Article) error {
+	if articles == nil {
+		articles = []Article{}
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := putJSON(tx.Bucket(bucketFeedState), []byte(state.URL), state); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketArticles), []byte(state.URL), articles)
+	})
+}
+
+func (s *BoltStore) FeedArticles(url string) ([]Article, error) {
+	var articles []Article
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketArticles).Get([]byte(url))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &articles)
+	})
+	return articles, err
+}
+
+func (s *BoltStore) PruneFeedData(keep []string) (int, error) {
+	keepSet := make(map[string]bool, len(keep))
+	for _, url := range keep {
+		keepSet[url] = true
+	}
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketArticles, bucketFeedState} {
+			c := tx.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				if keepSet[string(k)] {
+					continue
+				}
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				if bytes.Equal(name, bucketArticles) {
+					removed++
+				}
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ==========================
+// Sesiones
+// ==========================
+
+func (s *BoltStore) CreateSession(id string, session Session) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketSessions), []byte(id), session)
+	})
+}
+
+func (s *BoltStore) GetSession(id string) (*Session, error) {
+	if id == "" {
+		return nil, ErrNotFound
+	}
+	var session Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketSessions).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *BoltStore) DeleteSession(id string) error {
+	if id == "" {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSessions).Delete([]byte(id))
+	})
+}
+
+func (s *BoltStore) ListSessions(username string) ([]Session, error) {
+	sessions := []Session{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSessions).ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return nil
+			}
+			if session.Username == username {
+				session.ID = string(k)
+				sessions = append(sessions, session)
+			}
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+func (s *BoltStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSessions).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil || now.After(session.Expires) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ==========================
+// Listas por usuario
+// ==========================
+
+func (s *BoltStore) AppendListItem(username, list string, item ListItem) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		userBucket, err := tx.Bucket(bucketLists).CreateBucketIfNotExists(ownerKey(username))
+		if err != nil {
+			return err
+		}
+		b, err := userBucket.CreateBucketIfNotExists([]byte(list))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putJSON(b, seqKey(seq), item)
+	})
+}
+
+// ImportListItems añade los elementos cuyo enlace todavía no está en la
+// lista y devuelve cuántos se añadieron.
+func (s *BoltStore) ImportListItems(username, list string, items []ListItem) (int, error) {
+	added := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		userBucket, err := tx.Bucket(bucketLists).CreateBucketIfNotExists(ownerKey(username))
+		if err != nil {
+			return err
+		}
+		b, err := userBucket.CreateBucketIfNotExists([]byte(list))
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		err = b.ForEach(func(_, v []byte) error {
+			var item ListItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			seen[item.Link] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if seen[item.Link] {
+				continue
+			}
+			seen[item.Link] = true
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := putJSON(b, seqKey(seq), item); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+func (s *BoltStore) ListItems(username, list string) ([]ListItem, error) {
+	items := []ListItem{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		userBucket := tx.Bucket(bucketLists).Bucket(ownerKey(username))
+		if userBucket == nil {
+			return nil
+		}
+		b := userBucket.Bucket([]byte(list))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var item ListItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+// ==========================
+// Estado de los artículos por usuario
+// ==========================
+
+func (s *BoltStore) ArticleStates(username string, ids []string) (map[string]ArticleState, error) {
+	states := make(map[string]ArticleState)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketArticleState).Bucket(ownerKey(username))
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			data := b.Get([]byte(id))
+			if data == nil {
+				continue
+			}
+			var state ArticleState
+			if err := json.Unmarshal(data, &state); err != nil {
+				continue
+			}
+			states[id] = state
+		}
+		return nil
+	})
+	return states, err
+}
+
+// updateArticleStates aplica fn al estado de cada id en una sola
+// transacción. Los estados que quedan vacíos se borran.
+func (s *BoltStore) updateArticleStates(username string, ids []string, fn func(id string, state *ArticleState)) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(bucketArticleState).CreateBucketIfNotExists(ownerKey(username))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id == "" {
+				continue
+			}
+			var state ArticleState
+			if data := b.Get([]byte(id)); data != nil {
+				json.Unmarshal(data, &state)
+			}
+			fn(id, &state)
+			if state.IsEmpty() {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+				continue
+			}
+			state.UpdatedAt = now
+			if err := putJSON(b, []byte(id), state); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) SetRead(username string, ids []string, read bool) error {
+	return s.updateArticleStates(username, ids, func(_ string, state *ArticleState) {
+		state.Read = read
+	})
+}
+
+func (s *BoltStore) SetStarred(username, id string, starred bool) error {
+	return s.updateArticleStates(username, []string{id}, func(_ string, state *ArticleState) {
+		state.Starred = starred
+	})
+}
+
+func (s *BoltStore) SetPosition(username, id string, seconds int) error {
+	if seconds < 0 {
+		seconds = 0
+	}
+	return s.updateArticleStates(username, []string{id}, func(_ string, state *ArticleState) {
+		state.Position = seconds
+	})
+}
+
+func (s *BoltStore) MarkArticles(username string, marks map[string]ArticleMark) error {
+	ids := make([]string, 0, len(marks))
+	for id := range marks {
+		ids = append(ids, id)
+	}
+	return s.updateArticleStates(username, ids, func(id string, state *ArticleState) {
+		mark := marks[id]
+		state.Hidden = state.Hidden || mark.Hidden
+		state.Read = state.Read || mark.Read
+		state.Priority = state.Priority || mark.Priority
+		for _, tag := range mark.Tags {
+			if !slices.Contains(state.Tags, tag) {
+				state.Tags = append(state.Tags, tag)
+			}
+		}
+	})
+}
+
+func (s *BoltStore) PruneArticleStates(cutoff time.Time, live map[string]bool) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(bucketArticleState)
+		// Recoger primero los usuarios: no se debe modificar un bucket
+		// mientras se recorre con ForEach
+		var owners [][]byte
+		root.ForEach(func(owner, v []byte) error {
+			if v == nil {
+				owners = append(owners, append([]byte(nil), owner...))
+			}
+			return nil
+		})
+		for _, owner := range owners {
+			c := root.Bucket(owner).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var state ArticleState
+				if err := json.Unmarshal(v, &state); err == nil && state.Starred {
+					continue
+				}
+				// Mientras el artículo siga en algún feed su estado se conserva
+				if live[string(k)] || !state.UpdatedAt.Before(cutoff) {
+					continue
+				}
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ==========================
+// Caché de contenido de artículos
+// ==========================
+
+func lruKey(accessed time.Time, url string) []byte {
+	return append(seqKey(uint64(accessed.UnixNano())), url...)
+}
+
+func contentBytes(tx *bolt.Tx) int64 {
+	data := tx.Bucket(bucketMeta).Get(metaContentBytes)
+	if len(data) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+func setContentBytes(tx *bolt.Tx, total int64) error {
+	if total < 0 {
+		total = 0
+	}
+	return tx.Bucket(bucketMeta).Put(metaContentBytes, seqKey(uint64(total)))
+}
+
+// putContent guarda entry y su clave en el índice; devuelve su tamaño
+func putContent(tx *bolt.Tx, entry CachedContent) (int64, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Bucket(bucketContent).Put([]byte(entry.URL), data); err != nil {
+		return 0, err
+	}
+	size := int64(len(data))
+	return size, tx.Bucket(bucketContentLRU).Put(lruKey(entry.AccessedAt, entry.URL), seqKey(uint64(size)))
+}
+
+// deleteContent borra url de la caché y del índice; devuelve los bytes liberados
+func deleteContent(tx *bolt.Tx, url string) (int64, error) {
+	b := tx.Bucket(bucketContent)
+	data := b.Get([]byte(url))
+	if data == nil {
+		return 0, nil
+	}
+	size := int64(len(data))
+	var entry CachedContent
+	if err := json.Unmarshal(data, &entry); err == nil {
+		if err := tx.Bucket(bucketContentLRU).Delete(lruKey(entry.AccessedAt, url)); err != nil {
+			return 0, err
+		}
+	}
+	return size, b.Delete([]byte(url))
+}
+
+func (s *BoltStore) GetContent(url string) (*CachedContent, error) {
+	var entry CachedContent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketContent).Get([]byte(url))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Anotar el acceso para el LRU. Con precisión de minutos basta y se
+	// evita una escritura en cada lectura; si falla, la entrada sigue valiendo.
+	now := time.Now().UTC()
+	if now.Sub(entry.AccessedAt) > time.Minute {
+		s.db.Update(func(tx *bolt.Tx) error {
+			// Releer: otra petición puede haberla cambiado entretanto
+			var touched CachedContent
+			data := tx.Bucket(bucketContent).Get([]byte(url))
+			if data == nil || json.Unmarshal(data, &touched) != nil {
+				return nil
+			}
+			freed, err := deleteContent(tx, url)
+			if err != nil {
+				return err
+			}
+			touched.AccessedAt = now
+			size, err := putContent(tx, touched)
+			if err != nil {
+				return err
+			}
+			return setContentBytes(tx, contentBytes(tx)-freed+size)
+		})
+	}
+	return &entry, nil
+}
+
+func (s *BoltStore) PutContent(entry CachedContent, maxBytes int64) (int, error) {
+	if entry.AccessedAt.IsZero() {
+		entry.AccessedAt = time.Now().UTC()
+	}
+	evicted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		freed, err := deleteContent(tx, entry.URL)
+		if err != nil {
+			return err
+		}
+		size, err := putContent(tx, entry)
+		if err != nil {
+			return err
+		}
+		total := contentBytes(tx) - freed + size
+
+		// Recoger primero las víctimas, de la menos usada recientemente a la
+		// más, sin modificar el índice mientras se recorre
+		var victims []string
+		excess := total - maxBytes
+		c := tx.Bucket(bucketContentLRU).Cursor()
+		for k, v := c.First(); k != nil && excess > 0; k, v = c.Next() {
+			url := string(k[8:])
+			if url == entry.URL {
+				continue
+			}
+			victims = append(victims, url)
+			excess -= int64(binary.BigEndian.Uint64(v))
+		}
+		for _, url := range victims {
+			freed, err := deleteContent(tx, url)
+			if err != nil {
+				return err
+			}
+			total -= freed
+			evicted++
+		}
+		return setContentBytes(tx, total)
+	})
+	return evicted, err
+}
+
+func (s *BoltStore) PruneContent(cutoff time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var expired []string
+		tx.Bucket(bucketContent).ForEach(func(k, v []byte) error {
+			var entry CachedContent
+			if err := json.Unmarshal(v, &entry); err != nil || entry.FetchedAt.Before(cutoff) {
+				expired = append(expired, string(k))
+			}
+			return nil
+		})
+		total := contentBytes(tx)
+		for _, url := range expired {
+			freed, err := deleteContent(tx, url)
+			if err != nil {
+				return err
+			}
+			total -= freed
+			removed++
+		}
+		return setContentBytes(tx, total)
+	})
+	return removed, err
+}
+
+// ==========================
+// Copias offline
+// ==========================
+
+func (s *BoltStore) GetSnapshot(url string) (*Snapshot, error) {
+	var snapshot Snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketSnapshots).Get([]byte(url))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &snapshot)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *BoltStore) SnapshotTimes(urls []string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSnapshots)
+		for _, url := range urls {
+			data := b.Get([]byte(url))
+			if data == nil {
+				continue
+			}
+			var snapshot struct {
+				FetchedAt time.Time `json:"fetched_at"`
+			}
+			if err := json.Unmarshal(data, &snapshot); err == nil {
+				times[url] = snapshot.FetchedAt
+			}
+		}
+		return nil
+	})
+	return times, err
+}
+
+func (s *BoltStore) SaveSnapshot(snapshot Snapshot, images map[string]SnapshotImage) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketImages)
+		for id, image := range images {
+			if b.Get([]byte(id)) != nil {
+				continue
+			}
+			// Tipo MIME, un byte 0 y los bytes de la imagen: en JSON (base64)
+			// ocuparían un tercio más
+			value := append(append([]byte(image.Type), 0), image.Data...)
+			if err := b.Put([]byte(id), value); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(bucketAttempts).Delete([]byte(snapshot.URL)); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketSnapshots), []byte(snapshot.URL), snapshot)
+	})
+}
+
+func (s *BoltStore) GetSnapshotAttempt(url string) (*SnapshotAttempt, error) {
+	var attempt SnapshotAttempt
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketAttempts).Get([]byte(url))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &attempt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *BoltStore) SaveSnapshotAttempt(attempt SnapshotAttempt) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketAttempts), []byte(attempt.URL), attempt)
+	})
+}
+
+func (s *BoltStore) GetSnapshotImage(id string) (*SnapshotImage, error) {
+	var image SnapshotImage
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketImages).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		mime, body, _ := bytes.Cut(data, []byte{0})
+		// Los datos de bbolt sólo valen dentro de la transacción
+		image = SnapshotImage{Type: string(mime), Data: append([]byte(nil), body...)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// ==========================
+// Smart feeds
+// ==========================
+
+func (s *BoltStore) ListSmartFeeds(username string) ([]SmartFeed, error) {
+	var feeds []SmartFeed
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketSmartFeeds).Get(ownerKey(username))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &feeds)
+	})
+	return feeds, err
+}
+
+func (s *BoltStore) SaveSmartFeed(username string, feed SmartFeed) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSmartFeeds)
+		var feeds []SmartFeed
+		if data := b.Get(ownerKey(username)); data != nil {
+			if err := json.Unmarshal(data, &feeds); err != nil {
+				return err
+			}
+		}
+		replaced := false
+		for i := range feeds {
+			if feeds[i].ID == feed.ID {
+				if feeds[i].Token != feed.Token {
+					if err := tx.Bucket(bucketSmartTokens).Delete([]byte(feeds[i].Token)); err != nil {
+						return err
+					}
+				}
+				feeds[i] = feed
+				replaced = true
+			}
+		}
+		if !replaced {
+			feeds = append(feeds, feed)
+		}
+		owner := append(append(ownerKey(username), 0), feed.ID...)
+		if err := tx.Bucket(bucketSmartTokens).Put([]byte(feed.Token), owner); err != nil {
+			return err
+		}
+		return putJSON(b, ownerKey(username), feeds)
+	})
+}
+
+func (s *BoltStore) DeleteSmartFeed(username, id string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSmartFeeds)
+		data := b.Get(ownerKey(username))
+		if data == nil {
+			return nil
+		}
+		var feeds []SmartFeed
+		if err := json.Unmarshal(data, &feeds); err != nil {
+			return err
+		}
+		updated := make([]SmartFeed, 0, len(feeds))
+		for _, f := range feeds {
+			if f.ID == id {
+				found = true
+				if err := tx.Bucket(bucketSmartTokens).Delete([]byte(f.Token)); err != nil {
+					return err
+				}
+				continue
+			}
+			updated = append(updated, f)
+		}
+		if !found {
+			return nil
+		}
+		return putJSON(b, ownerKey(username), updated)
+	})
+	return found, err
+}
+
+func (s *BoltStore) SmartFeedByToken(token string) (string, *SmartFeed, error) {
+	var username string
+	var feed *SmartFeed
+	err := s.db.View(func(tx *bolt.Tx) error {
+		owner := tx.Bucket(bucketSmartTokens).Get([]byte(token))
+		if owner == nil || token == "" {
+			return ErrNotFound
+		}
+		key, id, _ := bytes.Cut(owner, []byte{0})
+		var feeds []SmartFeed
+		if data := tx.Bucket(bucketSmartFeeds).Get(key); data != nil {
+			if err := json.Unmarshal(data, &feeds); err != nil {
+				return err
+			}
+		}
+		for i := range feeds {
+			if feeds[i].ID == string(id) {
+				username, feed = string(key), &feeds[i]
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if username == defaultOwner {
+		username = ""
+	}
+	return username, feed, err
+}
+
+// ==========================
+// Reglas de filtrado
+// ==========================
+
+func getRules(tx *bolt.Tx, username string) ([]Rule, error) {
+	var rules []Rule
+	if data := tx.Bucket(bucketRules).Get(ownerKey(username)); data != nil {
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (s *BoltStore) ListRules(username string) ([]Rule, error) {
+	var rules []Rule
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		rules, err = getRules(tx, username)
+		return err
+	})
+	return rules, err
+}
+
+func (s *BoltStore) SaveRule(username string, rule Rule) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rules, err := getRules(tx, username)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for i := range rules {
+			if rules[i].ID == rule.ID {
+				rules[i] = rule
+				replaced = true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+		return putJSON(tx.Bucket(bucketRules), ownerKey(username), rules)
+	})
+}
+
+func (s *BoltStore) DeleteRule(username, id string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		rules, err := getRules(tx, username)
+		if err != nil {
+			return err
+		}
+		updated := make([]Rule, 0, len(rules))
+		for _, rule := range rules {
+			if rule.ID == id {
+				found = true
+				continue
+			}
+			updated = append(updated, rule)
+		}
+		if !found {
+			return nil
+		}
+		return putJSON(tx.Bucket(bucketRules), ownerKey(username), updated)
+	})
+	return found, err
+}
+
+// ==========================
+// Favoritos
+// ==========================
+
+func (s *BoltStore) ListFavorites() ([]FavoriteArticle, error) {
+	favorites := []FavoriteArticle{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFavorites).ForEach(func(_, v []byte) error {
+			var fav FavoriteArticle
+			if err := json.Unmarshal(v, &fav); err != nil {
+				return err
+			}
+			favorites = append(favorites, fav)
+			return nil
+		})
+	})
+	return favorites, err
+}
+
+func findFavorite(b *bolt.Bucket, link string) []byte {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var fav FavoriteArticle
+		if json.Unmarshal(v, &fav) == nil && fav.Link == link {
+			return k
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) AddFavorite(article FavoriteArticle) (bool, error) {
+	added := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketFavorites)
+		if findFavorite(b, article.Link) != nil {
+			return nil
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		added = true
+		return putJSON(b, seqKey(seq), article)
+	})
+	return added, err
+}
+
+// ToggleFavorite elimina el favorito si ya existía o lo añade si no.
+// Devuelve true si el artículo queda como favorito.
+func (s *BoltStore) ToggleFavorite(article FavoriteArticle) (bool, error) {
+	isFav := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketFavorites)
+		if k := findFavorite(b, article.Link); k != nil {
+			return b.Delete(k)
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		isFav = true
+		return putJSON(b, seqKey(seq), article)
+	})
+	return isFav, err
+}
+
+// ==========================
+// Metadatos
+// ==========================
+
+func (s *BoltStore) GetMeta(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketMeta).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), data...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) PutMeta(key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put([]byte(key), value)
+	})
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sufijo con el que se renombran los ficheros JSON ya importados
+const MigratedSuffix = ".migrated"
+
+type UserMigrationCounts struct {
+	Feeds int
+	Saved int
+	Loved int
+}
+
+type MigrationReport struct {
+	Users     int
+	Favorites int
+	PerUser   map[string]*UserMigrationCounts
+	Renamed   []string
+	Errors    []error
+}
+
+func (r *MigrationReport) counts(username string) *UserMigrationCounts {
+	if username == "" {
+		username = defaultOwner
+	}
+	c, ok := r.PerUser[username]
+	if !ok {
+		c = &UserMigrationCounts{}
+		r.PerUser[username] = c
+	}
+	return c
+}
+
+// MigrateLegacyJSON importa los ficheros JSON heredados (users.json,
+// favorites.json, feeds_*.json, *_saved.json, *_loved.json) de dir al
+// almacén y los renombra con MigratedSuffix. Es idempotente: los registros
+// que ya existen en el almacén se ignoran. Los *_loaded.json sólo indicaban
+// qué enlaces se habían mostrado, no leído, así que se archivan sin importar.
+func MigrateLegacyJSON(dir string, s Store) (*MigrationReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	report := &MigrationReport{PerUser: make(map[string]*UserMigrationCounts)}
+	for _, path := range paths {
+		imported, err := migrateLegacyFile(path, s, report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+		if !imported {
+			continue
+		}
+		if err := os.Rename(path, path+MigratedSuffix); err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		report.Renamed = append(report.Renamed, filepath.Base(path))
+	}
+	return report, nil
+}
+
+func migrateLegacyFile(path string, s Store, report *MigrationReport) (bool, error) {
+	name := filepath.Base(path)
+	switch {
+	case name == "users.json":
+		return true, migrateUsers(path, s, report)
+	case name == "favorites.json":
+		return true, migrateFavorites(path, s, report)
+	case name == "feeds.json":
+		return true, migrateFeeds(path, "", s, report)
+	case strings.HasPrefix(name, "feeds_"):
+		return true, migrateFeeds(path, strings.TrimSuffix(strings.TrimPrefix(name, "feeds_"), ".json"), s, report)
+	case strings.HasSuffix(name, "_loaded.json"):
+		return true, nil
+	case strings.HasSuffix(name, "_saved.json"):
+		return true, migrateList(path, strings.TrimSuffix(name, "_saved.json"), "saved", s, report)
+	case strings.HasSuffix(name, "_loved.json"):
+		return true, migrateList(path, strings.TrimSuffix(name, "_loved.json"), "loved", s, report)
+	}
+	return false, nil
+}
+
+func readLegacyJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func migrateUsers(path string, s Store, report *MigrationReport) error {
+	var users []User
+	if err := readLegacyJSON(path, &users); err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Username == "" {
+			continue
+		}
+		err := s.CreateUser(user)
+		if err == ErrExists {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		report.Users++
+	}
+	return nil
+}
+
+func migrateFavorites(path string, s Store, report *MigrationReport) error {
+	var favorites []FavoriteArticle
+	if err := readLegacyJSON(path, &favorites); err != nil {
+		return err
+	}
+	for _, fav := range favorites {
+		if fav.Link == "" {
+			continue
+		}
+		added, err := s.AddFavorite(fav)
+		if err != nil {
+			return err
+		}
+		if added {
+			report.Favorites++
+		}
+	}
+	return nil
+}
+
+func migrateFeeds(path, username string, s Store, report *MigrationReport) error {
+	var feeds []Feed
+	if err := readLegacyJSON(path, &feeds); err != nil {
+		return err
+	}
+	// Un fichero con [] es un usuario que borró todos sus feeds: se guarda la
+	// lista vacía para que no reciba los feeds por defecto
+	if feeds != nil {
+		if _, err := s.SeedFeeds(username, nil); err != nil {
+			return err
+		}
+	}
+	for _, feed := range feeds {
+		if feed.URL == "" {
+			continue
+		}
+		added, err := s.AddFeed(username, feed)
+		if err != nil {
+			return err
+		}
+		if added {
+			report.counts(username).Feeds++
+		}
+	}
+	return nil
+}
+
+// Las listas se guardaban con appendJSONItem como map[string]any, así que
+// se leen sin tipo y se normalizan campo a campo.
+func migrateList(path, username, list string, s Store, report *MigrationReport) error {
+	var raw []map[string]any
+	if err := readLegacyJSON(path, &raw); err != nil {
+		return err
+	}
+	items := make([]ListItem, 0, len(raw))
+	for _, m := range raw {
+		item := ListItem{
+			Title:  legacyString(m, "title", "Title"),
+			Link:   legacyString(m, "link", "Link"),
+			Source: legacyString(m, "source", "Source"),
+			User:   legacyString(m, "user", "User"),
+		}
+		if item.Link == "" {
+			continue
+		}
+		if item.User == "" {
+			item.User = username
+		}
+		items = append(items, item)
+	}
+	added, err := s.ImportListItems(username, list, items)
+	if err != nil {
+		return err
+	}
+	c := report.counts(username)
+	if list == "loved" {
+		c.Loved += added
+	} else {
+		c.Saved += added
+	}
+	return nil
+}
+
+func legacyString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok || v == nil {
+			continue
+		}
+		if str, ok := v.(string); ok {
+			return strings.TrimSpace(str)
+		}
+		return fmt.Sprint(v)
+	}
+	return ""
+}
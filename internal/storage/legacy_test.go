@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// Ficheros tal y como los dejaba la versión con JSON
+var legacyFiles = map[string]string{
+	"users.json":     `[{"username":"alice","password":"x"},{"username":"bob","password":"y"},{"username":""}]`,
+	"favorites.json": `[{"title":"Fav","link":"https://example.com/fav"},{"title":"Sin enlace"}]`,
+	"feeds.json":     `[{"url":"https://example.com/shared","active":true}]`,
+	"feeds_alice.json": `[
+		{"url":"https://example.com/a","active":true},
+		{"url":"https://example.com/b","active":false},
+		{"url":""}
+	]`,
+	"feeds_bob.json":    `[]`,
+	"feeds_carol.json":  ``,
+	"alice_saved.json":  `[{"title":"Uno","link":"https://example.com/1","source":"Mises","user":"alice"},{"Title":" Dos ","Link":"https://example.com/2","Source":"Hayek"},{"title":"Sin enlace","link":null}]`,
+	"alice_loved.json":  `[{"Link":"https://example.com/1","title":"Uno"},{"link":"https://example.com/1"}]`,
+	"alice_loaded.json": `["https://example.com/1"]`,
+	"bob_saved.json":    `[{"Link":"https://example.com/3","title":3}]`,
+	"settings.json":     `{"theme":"dark"}`,
+	"broken_saved.json": `[{"link":`,
+}
+
+func writeLegacyFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range legacyFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMigrateLegacyJSON(t *testing.T) {
+	dir := writeLegacyFiles(t)
+	s := openTestStore(t)
+
+	report, err := MigrateLegacyJSON(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 2 || report.Favorites != 1 {
+		t.Errorf("Users, Favorites = %d, %d, want 2, 1", report.Users, report.Favorites)
+	}
+	wantCounts := map[string]UserMigrationCounts{
+		defaultOwner: {Feeds: 1},
+		"alice":      {Feeds: 2, Saved: 2, Loved: 1},
+		"bob":        {Saved: 1},
+	}
+	gotCounts := make(map[string]UserMigrationCounts)
+	for user, c := range report.PerUser {
+		gotCounts[user] = *c
+	}
+	if !reflect.DeepEqual(gotCounts, wantCounts) {
+		t.Errorf("PerUser = %+v, want %+v", gotCounts, wantCounts)
+	}
+	if len(report.Errors) != 1 {
+		t.Errorf("Errors = %v, want only broken_saved.json", report.Errors)
+	}
+
+	// Se renombran los importados; los desconocidos y los que fallan se quedan
+	wantRenamed := []string{"alice_loaded.json", "alice_loved.json", "alice_saved.json", "bob_saved.json", "favorites.json",
+		"feeds.json", "feeds_alice.json", "feeds_bob.json", "feeds_carol.json", "users.json"}
+	if !reflect.DeepEqual(report.Renamed, wantRenamed) {
+		t.Errorf("Renamed = %v, want %v", report.Renamed, wantRenamed)
+	}
+	for name := range legacyFiles {
+		_, errJSON := os.Stat(filepath.Join(dir, name))
+		_, errMigrated := os.Stat(filepath.Join(dir, name+MigratedSuffix))
+		renamed := errors.Is(errJSON, os.ErrNotExist) && errMigrated == nil
+		kept := errJSON == nil && errors.Is(errMigrated, os.ErrNotExist)
+		if want := slices.Contains(wantRenamed, name); (want && !renamed) || (!want && !kept) {
+			t.Errorf("%s: renamed = %v, want %v", name, renamed, want)
+		}
+	}
+
+	// Claves en minúsculas y mayúsculas, valores no textuales y sin enlace
+	saved, err := s.ListItems("alice", "saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSaved := []ListItem{
+		{Title: "Uno", Link: "https://example.com/1", Source: "Mises", User: "alice"},
+		{Title: "Dos", Link: "https://example.com/2", Source: "Hayek", User: "alice"},
+	}
+	if !reflect.DeepEqual(saved, wantSaved) {
+		t.Errorf("alice saved = %+v, want %+v", saved, wantSaved)
+	}
+	bobSaved, err := s.ListItems("bob", "saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ListItem{{Title: "3", Link: "https://example.com/3", User: "bob"}}; !reflect.DeepEqual(bobSaved, want) {
+		t.Errorf("bob saved = %+v, want %+v", bobSaved, want)
+	}
+
+	// [] es una lista vacía explícita; un fichero vacío no guarda nada
+	bobFeeds, err := s.ListFeeds("bob")
+	if err != nil || len(bobFeeds) != 0 {
+		t.Errorf("bob feeds = %v, %v, want an empty list", bobFeeds, err)
+	}
+	if _, err := s.ListFeeds("carol"); err != ErrNotFound {
+		t.Errorf("carol feeds error = %v, want ErrNotFound", err)
+	}
+
+	// Una segunda pasada no encuentra nada que importar
+	again, err := MigrateLegacyJSON(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Users != 0 || again.Favorites != 0 || len(again.PerUser) != 0 || len(again.Renamed) != 0 || len(again.Errors) != 1 {
+		t.Errorf("second run = %+v, want a no-op", again)
+	}
+}
+
+func TestMigrateLegacyJSONSkipsExisting(t *testing.T) {
+	s := openTestStore(t)
+	if _, err := MigrateLegacyJSON(writeLegacyFiles(t), s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFeeds("bob", []Feed{{URL: "https://example.com/nuevo", Active: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Los mismos ficheros otra vez (p. ej. restaurados de una copia) no
+	// duplican nada ni pisan lo que el usuario cambió después
+	report, err := MigrateLegacyJSON(writeLegacyFiles(t), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 0 || report.Favorites != 0 {
+		t.Errorf("Users, Favorites = %d, %d, want 0, 0", report.Users, report.Favorites)
+	}
+	for user, c := range report.PerUser {
+		if *c != (UserMigrationCounts{}) {
+			t.Errorf("PerUser[%s] = %+v, want zero", user, *c)
+		}
+	}
+	saved, _ := s.ListItems("alice", "saved")
+	if len(saved) != 2 {
+		t.Errorf("alice saved = %d items, want 2", len(saved))
+	}
+	feeds, _ := s.ListFeeds("bob")
+	if len(feeds) != 1 || feeds[0].URL != "https://example.com/nuevo" {
+		t.Errorf("bob feeds = %+v, want the list saved after the migration", feeds)
+	}
+}
+
+func TestLegacyString(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]any
+		want string
+	}{
+		{"lowercase", map[string]any{"link": "https://a"}, "https://a"},
+		{"capitalized", map[string]any{"Link": "https://a"}, "https://a"},
+		{"first key wins", map[string]any{"link": "https://a", "Link": "https://b"}, "https://a"},
+		{"null falls through", map[string]any{"link": nil, "Link": "https://b"}, "https://b"},
+		{"trims spaces", map[string]any{"link": "  https://a "}, "https://a"},
+		{"number", map[string]any{"link": float64(42)}, "42"},
+		{"bool", map[string]any{"Link": true}, "true"},
+		{"other case is not read", map[string]any{"LINK": "https://a"}, ""},
+		{"missing", map[string]any{}, ""},
+	}
+	for _, tt := range tests {
+		if got := legacyString(tt.m, "link", "Link"); got != tt.want {
+			t.Errorf("%s: legacyString() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+)
+
+type User struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Zona horaria IANA con la que se muestran las fechas (p. ej. "Europe/Madrid")
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Feed es una suscripción de un usuario. Los datos de FeedInfo se descubren
+// al descargar el feed; CustomName y Category los elige el usuario.
+type Feed struct {
+	URL    string `json:"url"`
+	Active bool   `json:"active"`
+	// Máximo de artículos del feed en el río; 0 usa el valor por defecto
+	MaxItems int `json:"max_items,omitempty"`
+
+	Title       string `json:"title,omitempty"`
+	SiteURL     string `json:"site_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	FaviconURL  string `json:"favicon_url,omitempty"`
+	CustomName  string `json:"custom_name,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+// FeedInfo son los metadatos publicados por el propio feed
+type FeedInfo struct {
+	Title       string `json:"title,omitempty"`
+	SiteURL     string `json:"site_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	FaviconURL  string `json:"favicon_url,omitempty"`
+}
+
+func (i FeedInfo) IsZero() bool {
+	return i == FeedInfo{}
+}
+
+// SetInfo copia en la suscripción los metadatos descubiertos
+func (f *Feed) SetInfo(info FeedInfo) {
+	f.Title = info.Title
+	f.SiteURL = info.SiteURL
+	f.Description = info.Description
+	f.FaviconURL = info.FaviconURL
+}
+
+// DisplayName es el nombre con el que se muestra el feed: el elegido por el
+// usuario, el título del feed o, en último caso, la URL.
+func (f Feed) DisplayName() string {
+	if f.CustomName != "" {
+		return f.CustomName
+	}
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.URL
+}
+
+// Article es un elemento de un feed. ID es estable entre descargas (se
+// deriva del GUID del item); Read y Starred son el estado del usuario que
+// lo está viendo y no se guardan con el artículo. Date es el texto de fecha
+// tal y como venía en el feed; Published, Updated y Fetched son las fechas
+// ya interpretadas, en UTC.
+type Article struct {
+	ID          string    `json:"id"`
+	FeedURL     string    `json:"feed_url"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link"`
+	Date        string    `json:"date"`
+	Published   time.Time `json:"published"`
+	Updated     time.Time `json:"updated"`
+	Fetched     time.Time `json:"fetched"`
+	Source      string    `json:"source"`
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description"`
+	// Miniatura y duración en segundos (vídeos, podcasts), si el feed las da
+	ImageURL   string      `json:"image_url,omitempty"`
+	Duration   int         `json:"duration,omitempty"`
+	Enclosures []Enclosure `json:"enclosures,omitempty"`
+	Read       bool        `json:"read,omitempty"`
+	Starred    bool        `json:"starred,omitempty"`
+	// Segundo por el que el usuario va escuchando/viendo el episodio
+	Position int `json:"position,omitempty"`
+	// Marcas de las reglas del usuario: silenciado, prioritario, etiquetas
+	Hidden   bool     `json:"hidden,omitempty"`
+	Priority bool     `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	IsFav    bool     `json:"-"`
+}
+
+// Enclosure es un fichero adjunto a un artículo: el audio de un episodio
+// de podcast, un vídeo...
+type Enclosure struct {
+	URL      string `json:"url"`
+	Type     string `json:"type,omitempty"`
+	Length   int64  `json:"length,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+// Kind devuelve "audio" o "video" si el adjunto se puede reproducir en el
+// navegador, o "" si no. Sin tipo MIME se mira la extensión.
+func (e Enclosure) Kind() string {
+	mime := strings.ToLower(e.Type)
+	switch {
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case mime != "" && mime != "application/octet-stream":
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(strings.SplitN(e.URL, "?", 2)[0]))
+	switch ext {
+	case ".mp3", ".m4a", ".aac", ".ogg", ".oga", ".opus", ".wav", ".flac":
+		return "audio"
+	case ".mp4", ".m4v", ".webm", ".mov":
+		return "video"
+	}
+	return ""
+}
+
+// Episode devuelve el primer adjunto reproducible del artículo, o nil
+func (a Article) Episode() *Enclosure {
+	for i := range a.Enclosures {
+		if a.Enclosures[i].Kind() != "" {
+			return &a.Enclosures[i]
+		}
+	}
+	return nil
+}
+
+// SortTime es la fecha por la que se ordena el artículo: la de publicación,
+// la de actualización si el feed no publica la primera, o la de descarga.
+func (a Article) SortTime() time.Time {
+	switch {
+	case !a.Published.IsZero():
+		return a.Published
+	case !a.Updated.IsZero():
+		return a.Updated
+	}
+	return a.Fetched
+}
+
+// ArticleState es el estado de lectura de un artículo para un usuario
+type ArticleState struct {
+	Read      bool      `json:"read,omitempty"`
+	Starred   bool      `json:"starred,omitempty"`
+	Position  int       `json:"position,omitempty"`
+	Hidden    bool      `json:"hidden,omitempty"`
+	Priority  bool      `json:"priority,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsEmpty indica que el estado no guarda nada (se puede borrar)
+func (s ArticleState) IsEmpty() bool {
+	return !s.Read && !s.Starred && s.Position == 0 && !s.Hidden && !s.Priority && len(s.Tags) == 0
+}
+
+// ArticleMark son los cambios que aplican las reglas de un usuario al
+// estado de un artículo. Sólo añaden: nunca desmarcan.
+type ArticleMark struct {
+	Hidden   bool     `json:"hidden,omitempty"`
+	Read     bool     `json:"read,omitempty"`
+	Priority bool     `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// FeedState guarda la planificación de descarga de cada URL de feed,
+// compartida entre todos los usuarios suscritos.
+type FeedState struct {
+	URL          string    `json:"url"`
+	LastFetch    time.Time `json:"last_fetch"`
+	NextFetch    time.Time `json:"next_fetch"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+
+	// Salud del feed
+	LastSuccess         time.Time `json:"last_success"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	HTTPStatus          int       `json:"http_status,omitempty"`
+
+	// Últimos metadatos descubiertos, para los nuevos suscriptores
+	Info FeedInfo `json:"info"`
+}
+
+// Tipos de sesión
+const (
+	SessionCookie  = ""
+	SessionRefresh = "refresh"
+)
+
+// Session se guarda indexada por el hash del token, nunca por el token en
+// claro. ID sólo se rellena al listar sesiones.
+type Session struct {
+	ID        string    `json:"id,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Username  string    `json:"username"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+type FavoriteArticle struct {
+	Title  string `json:"title"`
+	Link   string `json:"link"`
+	Date   string `json:"date"`
+	Source string `json:"source"`
+}
+
+// CachedContent es el contenido extraído de la página de un artículo o, si
+// la extracción falló, el error, para no reintentarla en cada petición.
+type CachedContent struct {
+	URL        string    `json:"url"` // URL normalizada
+	Content    string    `json:"content,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Failures   int       `json:"failures,omitempty"` // Fallos seguidos
+	FetchedAt  time.Time `json:"fetched_at"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// Snapshot es la copia offline de un artículo guardado: el contenido
+// extraído, con las imágenes apuntando a copias locales (SnapshotImage).
+type Snapshot struct {
+	URL         string    `json:"url"` // URL normalizada
+	OriginalURL string    `json:"original_url"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	Images      []string  `json:"images,omitempty"` // IDs de SnapshotImage
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// SnapshotAttempt anota los intentos fallidos de archivar una URL, para
+// reintentarla más tarde con espera creciente en lugar de en cada visita.
+type SnapshotAttempt struct {
+	URL         string    `json:"url"` // URL normalizada
+	Failures    int       `json:"failures"`
+	Error       string    `json:"error"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// SnapshotImage es una imagen descargada para las copias offline. El ID es
+// el hash del contenido, así que las imágenes repetidas se guardan una vez.
+type SnapshotImage struct {
+	Type string
+	Data []byte
+}
+
+// SmartFeed es una búsqueda guardada que se lee como un feed más: los
+// artículos del río que la cumplen. Token identifica su RSS público.
+type SmartFeed struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Query   string    `json:"query"`
+	Token   string    `json:"token"`
+	Created time.Time `json:"created"`
+}
+
+// Rule es una regla de filtrado del usuario: cuando se descarga un artículo
+// cuyo Field coincide con Pattern se le aplican Actions.
+type Rule struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Field   string    `json:"field"`   // title, description, source, author o any
+	Match   string    `json:"match"`   // keywords (separadas por comas) o regex
+	Pattern string    `json:"pattern"` // Palabras clave o expresión regular
+	Actions []string  `json:"actions"` // hide, read, save, love, tag, priority
+	Tag     string    `json:"tag,omitempty"`
+	Enabled bool      `json:"enabled"`
+	Created time.Time `json:"created"`
+}
+
+// ListItem es una entrada de las listas por usuario (saved, loved).
+type ListItem struct {
+	Title  string `json:"title"`
+	Link   string `json:"link"`
+	Source string `json:"source"`
+	User   string `json:"user"`
+}
+
+// Store agrupa toda la persistencia de la aplicación. Cada método es
+// atómico: las operaciones de lectura-modificación-escritura se ejecutan
+// dentro de una única transacción.
+type Store interface {
+	// Usuarios
+	GetUser(username string) (*User, error)
+	ListUsers() ([]User, error)
+	CreateUser(user User) error
+	// UpdateUser modifica con fn el usuario en una sola transacción.
+	// Devuelve ErrNotFound si no existe; si fn devuelve un error no se
+	// guarda nada.
+	UpdateUser(username string, fn func(*User) error) error
+
+	// Feeds por usuario. ListFeeds devuelve ErrNotFound si el usuario
+	// nunca ha guardado feeds (una lista vacía guardada no es lo mismo).
+	ListFeeds(username string) ([]Feed, error)
+	// SeedFeeds guarda feeds como lista inicial sólo si el usuario todavía
+	// no tiene ninguna; indica si se guardó.
+	SeedFeeds(username string, feeds []Feed) (bool, error)
+	AddFeed(username string, feed Feed) (bool, error)
+	SaveFeeds(username string, feeds []Feed) error
+	DeleteFeed(username, url string) (bool, error)
+	// UpdateFeed modifica con fn la suscripción url del usuario en una sola
+	// transacción. Devuelve ErrNotFound si no está suscrito; si fn devuelve
+	// un error no se guarda nada.
+	UpdateFeed(username, url string, fn func(*Feed) error) error
+	DistinctFeedURLs() ([]string, error)
+	// UpdateFeedInfo guarda los metadatos descubiertos en las suscripciones
+	// de todos los usuarios a esa URL
+	UpdateFeedInfo(url string, info FeedInfo) (int, error)
+
+	// Artículos descargados por el planificador, por URL de feed
+	GetFeedState(url string) (*FeedState, error)
+	SaveFeedState(state FeedState) error
+	SaveFetchResult(state FeedState, articles []Article) error
+	FeedArticles(url string) ([]Article, error)
+	// PruneFeedData borra el estado y los artículos de las URLs que ya no
+	// están en keep (feeds a los que no se suscribe nadie)
+	PruneFeedData(keep []string) (int, error)
+
+	// Sesiones
+	CreateSession(id string, session Session) error
+	GetSession(id string) (*Session, error)
+	DeleteSession(id string) error
+	ListSessions(username string) ([]Session, error)
+	DeleteExpiredSessions(now time.Time) (int, error)
+
+	// Listas por usuario (saved, loved)
+	AppendListItem(username, list string, item ListItem) error
+	ListItems(username, list string) ([]ListItem, error)
+	ImportListItems(username, list string, items []ListItem) (int, error)
+
+	// Estado leído/no leído/destacado por usuario y artículo
+	ArticleStates(username string, ids []string) (map[string]ArticleState, error)
+	SetRead(username string, ids []string, read bool) error
+	SetStarred(username, id string, starred bool) error
+	// SetPosition guarda por dónde va la reproducción de un episodio (0 la borra)
+	SetPosition(username, id string, seconds int) error
+	// MarkArticles aplica las marcas de las reglas (por ID de artículo)
+	MarkArticles(username string, marks map[string]ArticleMark) error
+	// PruneArticleStates borra, de todos los usuarios, los estados no
+	// destacados cuyo artículo ya no está en live y anteriores a cutoff
+	PruneArticleStates(cutoff time.Time, live map[string]bool) (int, error)
+
+	// Caché de contenido de artículos por URL. GetContent devuelve
+	// ErrNotFound si no está y anota el acceso para el LRU.
+	GetContent(url string) (*CachedContent, error)
+	// PutContent guarda entry y expulsa las entradas usadas hace más tiempo
+	// hasta que la caché ocupe como mucho maxBytes. Devuelve las expulsadas.
+	PutContent(entry CachedContent, maxBytes int64) (int, error)
+	// PruneContent borra las entradas descargadas antes de cutoff
+	PruneContent(cutoff time.Time) (int, error)
+
+	// Copias offline de artículos guardados, por URL normalizada
+	GetSnapshot(url string) (*Snapshot, error)
+	// SnapshotTimes devuelve cuándo se archivó cada URL que tiene copia
+	SnapshotTimes(urls []string) (map[string]time.Time, error)
+	// SaveSnapshot guarda la copia y sus imágenes (por ID) en una
+	// transacción, y borra los intentos fallidos anotados
+	SaveSnapshot(snapshot Snapshot, images map[string]SnapshotImage) error
+	GetSnapshotImage(id string) (*SnapshotImage, error)
+	// GetSnapshotAttempt devuelve ErrNotFound si nunca ha fallado
+	GetSnapshotAttempt(url string) (*SnapshotAttempt, error)
+	SaveSnapshotAttempt(attempt SnapshotAttempt) error
+
+	// Búsquedas guardadas (smart feeds) por usuario, en orden de creación
+	ListSmartFeeds(username string) ([]SmartFeed, error)
+	// SaveSmartFeed crea o actualiza (por ID) una búsqueda guardada
+	SaveSmartFeed(username string, feed SmartFeed) error
+	DeleteSmartFeed(username, id string) (bool, error)
+	// SmartFeedByToken busca la búsqueda de un RSS público y su dueño
+	SmartFeedByToken(token string) (string, *SmartFeed, error)
+
+	// Reglas de filtrado por usuario, en orden de creación
+	ListRules(username string) ([]Rule, error)
+	// SaveRule crea o actualiza (por ID) una regla
+	SaveRule(username string, rule Rule) error
+	DeleteRule(username, id string) (bool, error)
+
+	// Favoritos globales
+	ListFavorites() ([]FavoriteArticle, error)
+	AddFavorite(article FavoriteArticle) (bool, error)
+	ToggleFavorite(article FavoriteArticle) (bool, error)
+
+	// Valores internos de la aplicación (p. ej. el secreto JWT generado)
+	GetMeta(key string) ([]byte, error)
+	PutMeta(key string, value []byte) error
+
+	Close() error
+}
@@ -37,73 +37,78 @@ package main
 import (
 	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	mrand "math/rand/v2"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // Zonas horarias aunque el sistema no tenga tzdata
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+
+	"ancap-web/internal/auth"
+	"ancap-web/internal/readability"
+	"ancap-web/internal/rules"
+	"ancap-web/internal/search"
+	"ancap-web/internal/sources"
+	"ancap-web/internal/storage"
 )
 
-type Feed struct {
-	URL    string `json:"url"`
-	Active bool   `json:"active"`
-}
+type Feed = storage.Feed
 
-type Article struct {
-	Title       string
-	Link        string
-	Date        string
-	Source      string
-	Description string
-	IsFav       bool
-}
+type Article = storage.Article
 
-type FavoriteArticle struct {
-	Title  string `json:"title"`
-	Link   string `json:"link"`
-	Date   string `json:"date"`
-	Source string `json:"source"`
-}
+type FavoriteArticle = storage.FavoriteArticle
 
-type SavedArticle struct {
-	Title  string `json:"title"`
-	Link   string `json:"link"`
-	Source string `json:"source"`
-	User   string `json:"user"`
-}
+type SavedArticle = storage.ListItem
 
-type LovedArticle struct {
-	Title  string `json:"title"`
-	Link   string `json:"link"`
-	Source string `json:"source"`
-	User   string `json:"user"`
-}
+type LovedArticle = storage.ListItem
 
-type User struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
+type User = storage.User
 
-type Session struct {
-	Username string
-	Expires  time.Time
-}
+type Session = storage.Session
+
+type FeedState = storage.FeedState
+
+type FeedInfo = storage.FeedInfo
 
 type TemplateData struct {
 	Articles      []Article
 	ImportMessage string
 	Timestamp     int64
+	// Zona horaria del usuario; vacía si todavía no ha elegido ninguna
+	Timezone string
+	Location *time.Location
+	// Paginación del río: total de artículos y cursor de la página siguiente
+	Total      int
+	NextCursor string
+	// Feeds del usuario y filtro aplicado, para la barra de filtros
+	Feeds  []Feed
+	Filter riverFilter
+	// Búsquedas guardadas con sus artículos sin leer (pestaña SMART)
+	SmartFeeds []smartFeedCount
 }
 
 type OPML struct {
@@ -121,124 +126,314 @@ type Body struct {
 	Outlines []Outline `xml:"outline"`
 }
 
+// Outline es un feed (con xmlUrl) o una carpeta que agrupa otros outlines.
+// Disabled marca los feeds inactivos; no es estándar, pero los demás
+// lectores ignoran los atributos que no conocen.
 type Outline struct {
-	Text     string    `xml:"text,attr"`
-	Title    string    `xml:"title,attr"`
-	Type     string    `xml:"type,attr"`
-	XMLURL   string    `xml:"xmlUrl,attr"`
-	HTMLURL  string    `xml:"htmlUrl,attr"`
-	Outlines []Outline `xml:"outline"`
+	Text        string    `xml:"text,attr"`
+	Title       string    `xml:"title,attr,omitempty"`
+	Type        string    `xml:"type,attr,omitempty"`
+	XMLURL      string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string    `xml:"htmlUrl,attr,omitempty"`
+	Description string    `xml:"description,attr,omitempty"`
+	Category    string    `xml:"category,attr,omitempty"`
+	Disabled    string    `xml:"disabled,attr,omitempty"`
+	Outlines    []Outline `xml:"outline"`
 }
 
-type CachedFeed struct {
-	Articles  []Article
-	LastFetch time.Time
-	URL       string
-}
+// Almacenamiento persistente (usuarios, feeds, sesiones, listas...)
+var store storage.Store
 
-type CachedArticleContent struct {
-	Content   string
-	Timestamp time.Time
-	Success   bool
-}
+// Hash de contraseñas con bcrypt y tokens JWT para la API
+var authService *auth.Service
+var refreshTokenDuration = REFRESH_DEFAULT_EXPIRATION
 
-type FeedCache struct {
-	mutex sync.RWMutex
-	feeds map[string]CachedFeed
-}
+// Tiempo que se conserva el estado leído de un artículo que ya no está en
+// ningún feed (READ_RETENTION, p. ej. 720h)
+var articleStateRetention = ARTICLE_STATE_RETENTION
 
-type ArticleContentCache struct {
-	mutex    sync.RWMutex
-	articles map[string]CachedArticleContent
-}
+// Caché en disco del contenido extraído de los artículos (CONTENT_CACHE_MB,
+// CONTENT_CACHE_TTL)
+var contentCacheMaxBytes int64 = CONTENT_CACHE_MAX_BYTES
+var contentCacheTTL = CONTENT_CACHE_TTL
 
-var globalCache = &FeedCache{
-	feeds: make(map[string]CachedFeed),
-}
+// Índice de texto completo de artículos y guardados (pestaña SEARCH)
+var searchIndex *search.Index
 
-var articleContentCache = &ArticleContentCache{
-	articles: make(map[string]CachedArticleContent),
+const SESSION_DURATION = 24 * time.Hour
+const JWT_DEFAULT_EXPIRATION = 15 * time.Minute
+const REFRESH_DEFAULT_EXPIRATION = 30 * 24 * time.Hour
+const FEED_REFRESH_INTERVAL = 15 * time.Minute
+const SCHEDULER_TICK = 30 * time.Second
+const SCHEDULER_WORKERS = 8
+const FEED_MAX_BACKOFF = 24 * time.Hour
+const DB_PATH = "ancap.db"
+const ARTICLE_STATE_RETENTION = 90 * 24 * time.Hour
+const DEFAULT_FEED_MAX_ITEMS = 10
+const MAX_FEED_MAX_ITEMS = 500
+const RIVER_PAGE_SIZE = 50
+const RIVER_MAX_PAGE_SIZE = 200
+const CONTENT_CACHE_MAX_BYTES = 256 << 20
+const CONTENT_CACHE_TTL = 7 * 24 * time.Hour
+const CONTENT_RETRY_BACKOFF = 15 * time.Minute
+const CONTENT_MAX_RETRY_BACKOFF = 24 * time.Hour
+const SNAPSHOT_MAX_IMAGES = 30
+const SNAPSHOT_MAX_IMAGE_BYTES = 5 << 20
+const SNAPSHOT_MAX_ATTEMPTS = 8
+const SEARCH_INDEX_PATH = "search.bleve"
+const SEARCH_PAGE_SIZE = 20
+const SEARCH_MAX_PAGE_SIZE = 100
+const SMART_FEED_RSS_ITEMS = 50
+
+// Crea los usuarios por defecto si el almacén todavía no tiene ninguno.
+// Si queda un users.json heredado sin importar no se crea nada: "migrate"
+// no sobrescribe usuarios existentes y se perderían sus contraseñas.
+func seedDefaultUsers() {
+	users, err := store.ListUsers()
+	if err != nil {
+		log.Printf("❌ Error loading users: %v", err)
+		return
+	}
+	if len(users) > 0 {
+		return
+	}
+	if _, err := os.Stat("users.json"); err == nil {
+		log.Printf("⚠️ users.json found: run \"migrate\" to import it, default users not created")
+		return
+	}
+	for _, user := range []User{
+		{Username: "admin", Password: "admin123"},
+		{Username: "ancap", Password: "libertad"},
+	} {
+		hash, err := authService.HashPassword(user.Password)
+		if err != nil {
+			log.Printf("❌ Error hashing password for %s: %v", user.Username, err)
+			continue
+		}
+		user.Password = hash
+		if err := store.CreateUser(user); err != nil {
+			log.Printf("❌ Error creating default user %s: %v", user.Username, err)
+		}
+	}
 }
 
-var sessions = make(map[string]Session)
-var sessionMutex sync.RWMutex
+func validateLogin(username, password string) bool {
+	user, err := store.GetUser(username)
+	if err != nil {
+		return false
+	}
 
-const CACHE_DURATION = 1 * time.Minute
-const SESSION_DURATION = 24 * time.Hour
+	if auth.IsPasswordHash(user.Password) {
+		return authService.CheckPassword(password, user.Password)
+	}
 
-func loadUsers() []User {
-	file, err := os.Open("users.json")
+	// Contraseña heredada en texto plano: comparar y re-hashear al vuelo
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return false
+	}
+	hash, err := authService.HashPassword(password)
 	if err != nil {
-		// Si no existe users.json, crear usuario por defecto
-		defaultUsers := []User{
-			{"admin", "admin123"},
-			{"ancap", "libertad"},
+		log.Printf("❌ Error hashing password for %s: %v", username, err)
+		return true
+	}
+	// Sólo se cambia la contraseña, y sólo si sigue siendo la misma que se
+	// comprobó: otra escritura del usuario entretanto no se pierde ni se pisa
+	upgraded := false
+	err = store.UpdateUser(username, func(u *User) error {
+		if u.Password != user.Password {
+			return nil
 		}
-		saveUsers(defaultUsers)
-		return defaultUsers
+		u.Password = hash
+		upgraded = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Error upgrading password for %s: %v", username, err)
+	} else if upgraded {
+		log.Printf("🔐 Upgraded plaintext password to bcrypt for %s", username)
 	}
-	defer file.Close()
-
-	var users []User
-	json.NewDecoder(file).Decode(&users)
-	return users
+	return true
 }
 
-func saveUsers(users []User) error {
-	file, err := os.Create("users.json")
-	if err != nil {
-		return err
+// Token de sesión de 256 bits aleatorios
+func generateSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	defer file.Close()
-	return json.NewEncoder(file).Encode(users)
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func validateLogin(username, password string) bool {
-	users := loadUsers()
-	for _, user := range users {
-		if user.Username == username && user.Password == password {
-			return true
-		}
-	}
-	return false
+// En el almacén sólo se guarda el SHA-256 del token
+func sessionKey(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
 }
 
-func generateSessionID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+func createSession(username string, r *http.Request) (string, error) {
+	sessionID, _, err := newStoredSession(username, storage.SessionCookie, SESSION_DURATION, r)
+	return sessionID, err
 }
 
-func createSession(username string) string {
-	sessionMutex.Lock()
-	defer sessionMutex.Unlock()
+// Crea un token aleatorio y guarda su hash como sesión del tipo indicado
+func newStoredSession(username, kind string, ttl time.Duration, r *http.Request) (string, time.Time, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
-	sessionID := generateSessionID()
-	sessions[sessionID] = Session{
-		Username: username,
-		Expires:  time.Now().Add(SESSION_DURATION),
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
 	}
-	return sessionID
+	now := time.Now()
+	session := Session{
+		Kind:      kind,
+		Username:  username,
+		Created:   now,
+		Expires:   now.Add(ttl),
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+	if err := store.CreateSession(sessionKey(sessionID), session); err != nil {
+		return "", time.Time{}, err
+	}
+	return sessionID, session.Expires, nil
 }
 
 func validateSession(sessionID string) (string, bool) {
-	sessionMutex.RLock()
-	defer sessionMutex.RUnlock()
+	return validateStoredSession(sessionID, storage.SessionCookie)
+}
 
-	session, exists := sessions[sessionID]
-	if !exists || time.Now().After(session.Expires) {
+func validateStoredSession(sessionID, kind string) (string, bool) {
+	if sessionID == "" {
+		return "", false
+	}
+	session, err := store.GetSession(sessionKey(sessionID))
+	if err != nil || session.Kind != kind || time.Now().After(session.Expires) {
 		return "", false
 	}
 	return session.Username, true
 }
 
+// Devuelve el token de la cabecera "Authorization: Bearer <jwt>"
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+func validateBearerToken(token string) (string, bool) {
+	claims, err := authService.ValidateToken(token)
+	if err != nil {
+		return "", false
+	}
+	return claims.Username, claims.Username != ""
+}
+
+// El secreto JWT sale de JWT_SECRET o, si no está definido, se genera una
+// vez y se guarda en el almacén para que los tokens sobrevivan a reinicios.
+func loadJWTSecret() (string, error) {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return secret, nil
+	}
+	secret, err := store.GetMeta("jwt_secret")
+	if err == nil {
+		return string(secret), nil
+	}
+	if err != storage.ErrNotFound {
+		return "", err
+	}
+	generated, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	if err := store.PutMeta("jwt_secret", []byte(generated)); err != nil {
+		return "", err
+	}
+	return generated, nil
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, using %v", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// Cookie de sesión. COOKIE_INSECURE=1 permite servir por HTTP plano fuera
+// de localhost durante el desarrollo.
+func sessionCookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     "session_id",
+		Value:    value,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   os.Getenv("COOKIE_INSECURE") != "1",
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+}
+
 func clearExpiredSessions() {
-	sessionMutex.Lock()
-	defer sessionMutex.Unlock()
+	removed, err := store.DeleteExpiredSessions(time.Now())
+	if err != nil {
+		log.Printf("❌ Error clearing expired sessions: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("🧹 Removed %d expired sessions", removed)
+	}
+}
+
+// pruneArticleData aplica la política de retención: borra los artículos de
+// feeds sin suscriptores y el estado leído de los artículos que ya no están
+// en ningún feed o que superan articleStateRetention. Los destacados se
+// conservan siempre. También caduca el contenido cacheado tras contentCacheTTL.
+func pruneArticleData() {
+	urls, err := store.DistinctFeedURLs()
+	if err != nil {
+		log.Printf("❌ Error listing feed URLs for pruning: %v", err)
+		return
+	}
+	feedsRemoved, err := store.PruneFeedData(urls)
+	if err != nil {
+		log.Printf("❌ Error pruning feed data: %v", err)
+		return
+	}
 
-	for id, session := range sessions {
-		if time.Now().After(session.Expires) {
-			delete(sessions, id)
+	live := make(map[string]bool)
+	for _, url := range urls {
+		for _, a := range loadStoredArticles(url) {
+			live[a.ID] = true
 		}
 	}
+	statesRemoved, err := store.PruneArticleStates(time.Now().Add(-articleStateRetention), live)
+	if err != nil {
+		log.Printf("❌ Error pruning article states: %v", err)
+		return
+	}
+	if feedsRemoved > 0 || statesRemoved > 0 {
+		log.Printf("🧹 Pruned %d orphaned feeds and %d article states", feedsRemoved, statesRemoved)
+	}
+
+	contentRemoved, err := store.PruneContent(time.Now().Add(-contentCacheTTL))
+	if err != nil {
+		log.Printf("❌ Error pruning content cache: %v", err)
+		return
+	}
+	if contentRemoved > 0 {
+		log.Printf("🧹 Pruned %d expired cached articles", contentRemoved)
+	}
 }
 
 func authMiddleware(next http.Handler) http.Handler {
@@ -249,6 +444,21 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Token Bearer para scripts y clientes móviles
+		if token, ok := bearerToken(r); ok {
+			username, valid := validateBearerToken(token)
+			if !valid {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{"success": false, "error": "Invalid or expired token"})
+				return
+			}
+			r.Header.Set("X-Username", username)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Verificar sesión
 		cookie, err := r.Cookie("session_id")
 		if err != nil {
@@ -292,48 +502,54 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 }
 
 func getUserFromRequest(r *http.Request) string {
+	if token, ok := bearerToken(r); ok {
+		if username, valid := validateBearerToken(token); valid {
+			return username
+		}
+		log.Printf("❌ Invalid bearer token")
+		return ""
+	}
+
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		log.Printf("🍪 No session_id cookie found: %v", err)
 		return ""
 	}
 
-	log.Printf("🍪 Found session_id cookie: %s", cookie.Value)
-
 	if username, valid := validateSession(cookie.Value); valid {
 		log.Printf("✅ Valid session for user: %s", username)
 		return username
 	}
 
-	log.Printf("❌ Invalid session for cookie: %s", cookie.Value)
+	log.Printf("❌ Invalid or expired session cookie")
 	return ""
 }
 
-func getFeedsFilename(username string) string {
-	if username == "" {
-		return "feeds.json" // fallback para compatibilidad
-	}
-	return fmt.Sprintf("feeds_%s.json", username)
-}
-
 func loadFeeds() []Feed {
 	return loadFeedsForUser("")
 }
 
 func loadFeedsForUser(username string) []Feed {
-	filename := getFeedsFilename(username)
-	file, err := os.Open(filename)
-	if err != nil {
-		// Si no existe el archivo de feeds del usuario, crear algunos feeds de prueba
-		return []Feed{
-			{"https://feeds.feedburner.com/oreilly/radar", true},
-			{"https://rss.cnn.com/rss/edition.rss", true},
+	feeds, err := store.ListFeeds(username)
+	if err == storage.ErrNotFound {
+		// Si el usuario no tiene feeds guardados, crear algunos feeds de
+		// prueba. Se guardan para que el primer feed que añada se sume a
+		// ellos en lugar de reemplazarlos.
+		defaults := []Feed{
+			{URL: "https://feeds.feedburner.com/oreilly/radar", Active: true},
+			{URL: "https://rss.cnn.com/rss/edition.rss", Active: true},
 		}
+		if seeded, err := store.SeedFeeds(username, defaults); err != nil {
+			log.Printf("❌ Error saving default feeds for user '%s': %v", username, err)
+			return defaults
+		} else if seeded {
+			log.Printf("🌱 Default feeds saved for user '%s'", username)
+		}
+		feeds, err = store.ListFeeds(username)
+	}
+	if err != nil {
+		log.Printf("❌ Error loading feeds for user '%s': %v", username, err)
 	}
-	defer file.Close()
-
-	var feeds []Feed
-	json.NewDecoder(file).Decode(&feeds)
 	return feeds
 }
 
@@ -343,32 +559,20 @@ func saveFeed(feed Feed) error {
 
 func saveFeedForUser(feed Feed, username string) error {
 	log.Printf("💾 Attempting to save feed for user '%s': %s", username, feed.URL)
+	// Parte de lo que el usuario ve: si aún no tenía lista, los feeds de prueba
+	loadFeedsForUser(username)
 
-	feeds := loadFeedsForUser(username)
-	for _, f := range feeds {
-		if f.URL == feed.URL {
-			log.Printf("⏭️  Feed already exists for user '%s': %s", username, feed.URL)
-			return nil
-		}
-	}
-	feeds = append(feeds, feed)
-
-	filename := getFeedsFilename(username)
-	log.Printf("📁 Saving to file: %s", filename)
-
-	file, err := os.Create(filename)
+	added, err := store.AddFeed(username, feed)
 	if err != nil {
-		log.Printf("❌ Error creating file %s: %v", filename, err)
+		log.Printf("❌ Error saving feed for user '%s': %v", username, err)
 		return err
 	}
-	defer file.Close()
-
-	if err := json.NewEncoder(file).Encode(feeds); err != nil {
-		log.Printf("❌ Error encoding feeds to %s: %v", filename, err)
-		return err
+	if !added {
+		log.Printf("⏭️  Feed already exists for user '%s': %s", username, feed.URL)
+		return nil
 	}
 
-	log.Printf("✅ Successfully saved feed to %s", filename)
+	log.Printf("✅ Successfully saved feed for user '%s'", username)
 	return nil
 }
 
@@ -378,14 +582,7 @@ func saveFeeds(feeds []Feed) error {
 }
 
 func saveFeedsForUser(feeds []Feed, username string) error {
-	filename := getFeedsFilename(username)
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(feeds)
+	return store.SaveFeeds(username, feeds)
 }
 
 // Función para verificar si un feed está accesible
@@ -414,40 +611,18 @@ func fetchFeed(feedURL string) (*gofeed.Feed, error) {
 }
 
 func loadFavoriteArticles() []FavoriteArticle {
-	file, err := os.Open("favorites.json")
+	favorites, err := store.ListFavorites()
 	if err != nil {
+		log.Printf("❌ Error loading favorites: %v", err)
 		return []FavoriteArticle{}
 	}
-	defer file.Close()
-
-	var favorites []FavoriteArticle
-	json.NewDecoder(file).Decode(&favorites)
 	return favorites
 }
 
 func saveFavoriteArticle(article FavoriteArticle) {
-	favorites := loadFavoriteArticles()
-
-	for i, fav := range favorites {
-		if fav.Link == article.Link {
-			favorites = append(favorites[:i], favorites[i+1:]...)
-			file, err := os.Create("favorites.json")
-			if err != nil {
-				return
-			}
-			defer file.Close()
-			json.NewEncoder(file).Encode(favorites)
-			return
-		}
-	}
-
-	favorites = append(favorites, article)
-	file, err := os.Create("favorites.json")
-	if err != nil {
-		return
+	if _, err := store.ToggleFavorite(article); err != nil {
+		log.Printf("❌ Error saving favorite %s: %v", article.Link, err)
 	}
-	defer file.Close()
-	json.NewEncoder(file).Encode(favorites)
 }
 
 func isArticleFavorite(link string) bool {
@@ -460,30 +635,220 @@ func isArticleFavorite(link string) bool {
 	return false
 }
 
-func getCachedOrFetch(feedURL string) []Article {
-	globalCache.mutex.RLock()
-	cached, exists := globalCache.feeds[feedURL]
-	globalCache.mutex.RUnlock()
-	if exists && time.Since(cached.LastFetch) < CACHE_DURATION {
-		log.Printf("🟢 Cache HIT para %s (edad: %v)", feedURL, time.Since(cached.LastFetch))
-		return cached.Articles
+// renderEpisodePlayer genera el reproductor del audio o vídeo adjunto. El
+// JS de la página restaura data-position y va guardando por dónde se va.
+func renderEpisodePlayer(article Article, episode storage.Enclosure) string {
+	src := html.EscapeString(episode.URL)
+	info := `<a href="` + src + `" target="_blank" rel="noopener" class="action-link">DESCARGAR</a>`
+	if episode.Type != "" {
+		info += " · " + html.EscapeString(episode.Type)
 	}
-	log.Printf("🔴 Cache MISS para %s - fetching...", feedURL)
-	articles := fetchFeedArticles(feedURL)
-	globalCache.mutex.Lock()
-	globalCache.feeds[feedURL] = CachedFeed{
-		Articles:  articles,
-		LastFetch: time.Now(),
-		URL:       feedURL,
+	if episode.Length > 0 {
+		info += fmt.Sprintf(" · %.1f MB", float64(episode.Length)/(1<<20))
 	}
-	globalCache.mutex.Unlock()
-	return articles
+	if episode.Duration > 0 {
+		info += " · " + formatDuration(episode.Duration)
+	}
+	if article.Position > 0 {
+		info += " · continuar en " + formatDuration(article.Position)
+	}
+	return fmt.Sprintf(`
+                <div class="episode">
+                    <%[1]s class="episode-player" controls preload="none" data-id="%[2]s" data-position="%[3]d" src="%[4]s"></%[1]s>
+                    <div class="episode-info">%[5]s</div>
+                </div>`, episode.Kind(), article.ID, article.Position, src, info)
+}
+
+// formatDuration muestra segundos como "M:SS" o "H:MM:SS"
+func formatDuration(seconds int) string {
+	h, m, sec := seconds/3600, seconds/60%60, seconds%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+// renderRiverFilterBar genera la barra de filtros del río: un formulario GET
+// a "/" con los mismos parámetros que /api/articles.
+func renderRiverFilterBar(data TemplateData, location *time.Location) string {
+	filter := data.Filter
+	option := func(value, label string, selected bool) string {
+		attr := ""
+		if selected {
+			attr = " selected"
+		}
+		return `<option value="` + html.EscapeString(value) + `"` + attr + `>` + html.EscapeString(label) + `</option>`
+	}
+
+	feedOptions := option("", "todos los feeds", filter.Feed == "")
+	categories := make(map[string]bool)
+	for _, feed := range data.Feeds {
+		feedOptions += option(feed.URL, feed.DisplayName(), feed.URL == filter.Feed)
+		// Cada nivel de la ruta es también una categoría
+		parts := strings.Split(feed.Category, "/")
+		for i := range parts {
+			if category := strings.Join(parts[:i+1], "/"); category != "" {
+				categories[category] = true
+			}
+		}
+	}
+	sortedCategories := make([]string, 0, len(categories))
+	for category := range categories {
+		sortedCategories = append(sortedCategories, category)
+	}
+	sort.Strings(sortedCategories)
+	categoryOptions := option("", "todas las categorías", filter.Category == "")
+	for _, category := range sortedCategories {
+		categoryOptions += option(category, category, category == filter.Category)
+	}
+
+	dateValue := func(t time.Time, endOfDay bool) string {
+		if t.IsZero() {
+			return ""
+		}
+		if endOfDay {
+			t = t.Add(-time.Nanosecond)
+		}
+		return t.In(location).Format("2006-01-02")
+	}
+	checked := func(on bool) string {
+		if on {
+			return " checked"
+		}
+		return ""
+	}
+	smartSelect := ""
+	if len(data.SmartFeeds) > 0 {
+		smartOptions := option("", "todas las búsquedas", filter.Smart == "")
+		for _, smart := range data.SmartFeeds {
+			smartOptions += option(smart.ID, smart.Name, smart.ID == filter.Smart)
+		}
+		smartSelect = `
+                <select name="smart" onchange="this.form.submit()">` + smartOptions + `</select>`
+	}
+	tagInput := ""
+	if filter.Tag != "" {
+		tagInput = `
+                <input type="hidden" name="tag" value="` + html.EscapeString(filter.Tag) + `"> #` + html.EscapeString(filter.Tag)
+	}
+	active := ""
+	if filter != (riverFilter{}) {
+		active = ` <a href="/" class="filter-active">[X] quitar filtros</a>`
+	}
+
+	return `
+            <form id="river-filter" method="get" action="/">
+                <select name="feed" onchange="this.form.submit()">` + feedOptions + `</select>
+                <select name="category" onchange="this.form.submit()">` + categoryOptions + `</select>` + smartSelect + `
+                <input type="text" name="source" placeholder="fuente" value="` + html.EscapeString(filter.Source) + `" style="width:100px;">
+                desde <input type="date" name="since" value="` + dateValue(filter.Since, false) + `">
+                hasta <input type="date" name="until" value="` + dateValue(filter.Until, true) + `">
+                <label><input type="checkbox" name="unread" value="0"` + checked(filter.ShowAll) + ` onchange="this.form.submit()"> incluir leídos</label>
+                <label><input type="checkbox" name="episodes" value="1"` + checked(filter.Episodes) + ` onchange="this.form.submit()"> sólo episodios</label>
+                <label><input type="checkbox" name="priority" value="1"` + checked(filter.Priority) + ` onchange="this.form.submit()"> sólo prioritarios</label>
+                <label><input type="checkbox" name="muted" value="1"` + checked(filter.Muted) + ` onchange="this.form.submit()"> incluir silenciados</label>` + tagInput + `
+                <button type="submit" class="action-button">[FILTRAR]</button>` + active + `
+            </form>`
+}
+
+// renderSmartFeeds genera la lista de la pestaña SMART
+func renderSmartFeeds(feeds []smartFeedCount) string {
+	if len(feeds) == 0 {
+		return `
+            <div class="info">Todavía no hay ninguno.</div>`
+	}
+	out := ""
+	for _, smart := range feeds {
+		name := html.EscapeString(smart.Name)
+		out += `
+            <div class="smart-feed">
+                <a href="/?smart=` + url.QueryEscape(smart.ID) + `" class="smart-name">` + name + `</a> [<span class="smart-unread" data-id="` + html.EscapeString(smart.ID) + `">-</span>]
+                <span class="smart-query">` + html.EscapeString(smart.Query) + `</span>
+                <a href="` + html.EscapeString(smart.RSSURL) + `" class="action-button" target="_blank">[RSS]</a>
+                <button class="action-button" onclick="deleteSmartFeed('` + smart.ID + `', this.dataset.name)" data-name="` + name + `">[BORRAR]</button>
+            </div>`
+	}
+	return out
+}
+
+// renderArticleItem genera el HTML de un artículo del río. Lo usan la
+// página principal y la paginación (/api/articles?format=html).
+func renderArticleItem(article Article, location *time.Location) string {
+	shortDate, fullDate := "--/-- --:--", strings.ReplaceAll(article.Date, `"`, "'")
+	if t := article.SortTime(); !t.IsZero() {
+		t = t.In(location)
+		shortDate = t.Format("01/02 15:04")
+		fullDate = t.Format("2006-01-02 15:04:05 MST")
+	}
+	duration, thumbnail, player := "", "", ""
+	if article.Duration > 0 {
+		duration = `&nbsp;<span class="duration">[` + formatDuration(article.Duration) + `]</span>`
+	}
+	if article.ImageURL != "" {
+		thumbnail = `
+                <img class="article-thumb" loading="lazy" alt="" src="` + html.EscapeString(article.ImageURL) + `">`
+	}
+	if episode := article.Episode(); episode != nil {
+		player = renderEpisodePlayer(article, *episode)
+	}
+	lineClass := ""
+	if article.Read {
+		lineClass += " read"
+	}
+	if article.Starred {
+		lineClass += " starred"
+	}
+	if article.Priority {
+		lineClass += " priority"
+	}
+	for _, tag := range article.Tags {
+		duration += `&nbsp;<a class="article-tag" href="/?tag=` + url.QueryEscape(tag) + `">#` + html.EscapeString(tag) + `</a>`
+	}
+	return fmt.Sprintf(`
+        <div class="article-container">
+            <div class="article-line%s" data-url="%s" data-id="%s">
+                <span class="date-bracket" title="%s">[%s]</span>&nbsp;
+                <span class="source-name">%s</span>&nbsp;
+                <span class="title">%s</span>%s
+            </div>
+            <div class="article-content" data-article-url="%s">
+                <div style="height: 15px;"></div>
+                <div class="article-title-full" style="color: #ffffff; font-weight: 400; font-size: 16px; margin-bottom: 15px; line-height: 1.3;">%s</div>%s%s
+                <div class="article-description">%s</div>
+            <div class="article-actions" style="margin-top:8px;">
+                    <a href="#" class="action-link" onclick="event.preventDefault(); saveToList('loved', this)">LOVE [L]</a>
+                    <span style="margin:0 8px; color:#333;">|</span>
+                    <a href="#" class="action-link" onclick="event.preventDefault(); saveToList('saved', this)">SAVE [S]</a>
+                    <span style="margin:0 8px; color:#333;">|</span>
+                    <a href="#" class="action-link" onclick="event.preventDefault(); shareArticle(this)">SHARE</a>
+                </div>
+                <div class="article-full-content" style="display: none;"></div>
+                <div class="loading-indicator" style="display: none; color: #00ff00; margin: 10px 0;">⏳ Cargando contenido completo...</div>
+            </div>
+        </div>`,
+		lineClass,
+		article.Link,
+		article.ID,
+		fullDate,
+		shortDate,
+		article.Source,
+		article.Title,
+		duration,
+		article.Link,  // data-article-url for JS
+		article.Title, // Título completo en blanco
+		thumbnail,
+		player,
+		article.Description)
 }
 
 // ==========================================================================================================
 // 🚨 FRONTEND HARDCODEADO AQUÍ - NO MIGRAR A TEMPLATES 🚨
 // ==========================================================================================================
 func renderHomePage(w http.ResponseWriter, data TemplateData) {
+	location := data.Location
+	if location == nil {
+		location = time.Local
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
@@ -766,6 +1131,34 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             font-family: 'Roboto', sans-serif; /* Roboto para título completo */
             font-weight: 700;
         }
+        .article-full-content h2,
+        .article-full-content h3,
+        .article-full-content h4 {
+            color: #ffffff;
+            margin: 18px 0 8px;
+        }
+        .article-full-content pre {
+            background: #111;
+            color: #ccc;
+            padding: 10px;
+            overflow-x: auto;
+            white-space: pre;
+        }
+        .article-full-content code {
+            font-family: monospace;
+        }
+        .article-full-content blockquote {
+            border-left: 3px solid #444;
+            margin: 10px 0;
+            padding-left: 12px;
+        }
+        .article-full-content a {
+            color: #00ffff;
+        }
+        .article-full-content ul,
+        .article-full-content ol {
+            padding-left: 24px;
+        }
         .article-content br {
             margin: 6px 0;
         }
@@ -822,36 +1215,110 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
         .article-line.read .title {
             color: #666;
         }
-        
-        /* Modal/Window styles */
-        .modal {
-            display: none;
-            position: fixed;
-            z-index: 1000;
-            left: 0;
-            top: 0;
-            width: 100%;
-            height: 100%;
-            background: rgba(0, 0, 0, 0.8);
+        .article-line .duration {
+            color: #888;
+            font-size: 12px;
         }
-        .modal.active {
-            display: block;
+        .episode {
+            margin-bottom: 12px;
         }
-        .modal-content {
+        .episode-player {
+            width: 100%;
+            max-width: 560px;
+        }
+        video.episode-player {
+            max-height: 320px;
             background: #000;
-            margin: 5% auto;
-            padding: 20px;
-            border: 2px solid #00ff00;
-            width: 80%;
-            max-width: 800px;
-            color: #00ff00;
-            font-family: 'JetBrains Mono', monospace;
-            font-size: 14px;
-            position: relative;
-            max-height: 80vh;
-            overflow-y: auto;
         }
-        .modal-header {
+        .episode-info {
+            color: #888;
+            font-size: 12px;
+            margin-top: 4px;
+        }
+        .archived-mark {
+            color: #888;
+            font-size: 11px;
+        }
+        .archive-note {
+            color: #888;
+            font-size: 12px;
+            margin-bottom: 10px;
+        }
+        .smart-feed {
+            margin: 6px 0;
+        }
+        .smart-name {
+            color: #00ff00;
+        }
+        .smart-query {
+            color: #888;
+            margin: 0 10px;
+        }
+        .search-date {
+            color: #888;
+            font-size: 11px;
+        }
+        .search-snippet {
+            color: #aaa;
+            font-size: 12px;
+            margin: 2px 0 8px 0;
+        }
+        .search-snippet mark {
+            background: none;
+            color: #00ff00;
+        }
+        .article-thumb {
+            display: block;
+            max-width: 320px;
+            max-height: 180px;
+            margin-bottom: 10px;
+        }
+        .article-line.starred .title::before {
+            content: '★ ';
+            color: #ffff00;
+        }
+        .article-line.priority .source-name::before {
+            content: '!! ';
+            color: #ff3333;
+        }
+        .article-line.priority .title {
+            font-weight: bold;
+        }
+        .article-tag {
+            color: #00aaff;
+            font-size: 11px;
+            text-decoration: none;
+        }
+        
+        /* Modal/Window styles */
+        .modal {
+            display: none;
+            position: fixed;
+            z-index: 1000;
+            left: 0;
+            top: 0;
+            width: 100%;
+            height: 100%;
+            background: rgba(0, 0, 0, 0.8);
+        }
+        .modal.active {
+            display: block;
+        }
+        .modal-content {
+            background: #000;
+            margin: 5% auto;
+            padding: 20px;
+            border: 2px solid #00ff00;
+            width: 80%;
+            max-width: 800px;
+            color: #00ff00;
+            font-family: 'JetBrains Mono', monospace;
+            font-size: 14px;
+            position: relative;
+            max-height: 80vh;
+            overflow-y: auto;
+        }
+        .modal-header {
             font-size: 18px;
             font-weight: 400;
             margin-bottom: 20px;
@@ -914,6 +1381,61 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             padding-bottom: 10px;
             color: #00ff00;
         }
+        /* Barra de filtros del río (FEEDS) */
+        #river-filter {
+            font-size: 12px;
+            color: #888;
+            margin-bottom: 8px;
+        }
+        #river-filter select, #river-filter input {
+            background: #000;
+            color: #00ff00;
+            border: 1px solid #333;
+            font-family: inherit;
+            font-size: 12px;
+        }
+        #river-filter .filter-active { color: #ffff00; }
+        /* Estado de salud de los feeds (CONFIG) */
+        .feed-health-line {
+            font-size: 12px;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            line-height: 1.5;
+        }
+        .feed-health-line .health-ok { color: #00ff00; }
+        .feed-health-line .health-failing { color: #ff3333; font-weight: bold; }
+        .feed-health-line .health-pending { color: #ffff00; }
+        .feed-health-line .health-inactive { color: #666; }
+        .feed-setting {
+            width: 110px;
+            background: #000;
+            color: #ffff00;
+            border: 1px solid #333;
+            font-family: inherit;
+            font-size: 11px;
+        }
+        .feed-favicon {
+            width: 12px;
+            height: 12px;
+            vertical-align: middle;
+        }
+        .feed-max-items {
+            width: 48px;
+            background: #000;
+            color: #00ff00;
+            border: 1px solid #333;
+            font-family: inherit;
+            font-size: 11px;
+        }
+        .feed-health-error {
+            font-size: 11px;
+            color: #ff8888;
+            margin: 0 0 4px 20px;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
     </style>
     <script>
         let readArticles = new Set();
@@ -927,10 +1449,19 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
         function saveReadSet() {
             try { localStorage.setItem(READ_KEY, JSON.stringify(Array.from(readArticles))); } catch(e) {}
         }
-        function persistRead(url) {
+        function persistRead(url, id) {
             if (!url) return;
             readArticles.add(url);
             saveReadSet();
+            if (id) markArticles('read', [id]);
+        }
+        // Sincroniza el estado leído/no leído con el servidor
+        function markArticles(action, ids) {
+            return fetch('/api/articles/' + action, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ ids: ids })
+            }).catch(function(err) { console.log('❌ Error marking articles:', err); });
         }
         function applyReadState() {
             document.querySelectorAll('.article-line').forEach(line => {
@@ -941,6 +1472,347 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
 
         loadReadSet();
 
+        // Reproductor de episodios: se restaura la posición guardada al
+        // cargar y se va guardando mientras suena. Los eventos de audio y
+        // vídeo no burbujean, por eso se escuchan en fase de captura.
+        const episodePositionSaved = {};
+        function isEpisodePlayer(el) {
+            return el && el.classList && el.classList.contains('episode-player');
+        }
+        function saveEpisodePosition(player, seconds) {
+            const id = player.dataset.id;
+            if (!id) return;
+            player.dataset.position = Math.floor(seconds);
+            episodePositionSaved[id] = Date.now();
+            fetch('/api/articles/position', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: id, position: Math.floor(seconds) })
+            }).catch(function(err) { console.log('❌ Error saving position:', err); });
+        }
+        document.addEventListener('loadedmetadata', function(e) {
+            const player = e.target;
+            if (!isEpisodePlayer(player) || player.dataset.restored) return;
+            player.dataset.restored = '1';
+            const position = parseInt(player.dataset.position || '0', 10);
+            if (position > 0 && (!player.duration || position < player.duration - 5)) {
+                player.currentTime = position;
+            }
+        }, true);
+        document.addEventListener('play', function(e) {
+            if (!isEpisodePlayer(e.target)) return;
+            // Sólo un episodio sonando a la vez
+            document.querySelectorAll('.episode-player').forEach(function(other) {
+                if (other !== e.target && !other.paused) other.pause();
+            });
+        }, true);
+        document.addEventListener('timeupdate', function(e) {
+            const player = e.target;
+            if (!isEpisodePlayer(player) || player.paused) return;
+            if (Date.now() - (episodePositionSaved[player.dataset.id] || 0) < 15000) return;
+            saveEpisodePosition(player, player.currentTime);
+        }, true);
+        document.addEventListener('pause', function(e) {
+            const player = e.target;
+            if (isEpisodePlayer(player) && !player.ended) saveEpisodePosition(player, player.currentTime);
+        }, true);
+        document.addEventListener('ended', function(e) {
+            const player = e.target;
+            if (!isEpisodePlayer(player)) return;
+            // Episodio terminado: se olvida la posición y se marca leído
+            saveEpisodePosition(player, 0);
+            const line = document.querySelector('.article-line[data-id="' + player.dataset.id + '"]');
+            if (line) {
+                line.classList.add('read');
+                persistRead(line.dataset.url, player.dataset.id);
+            }
+        }, true);
+
+        function escapeHTML(str) {
+            return String(str == null ? '' : str)
+                .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;')
+                .replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+        }
+
+        // Zona horaria del usuario (pestaña CONFIG). Si aún no tiene ninguna se
+        // guarda la del navegador para las próximas cargas.
+        const USER_TIMEZONE = '` + data.Timezone + `';
+        function saveTimezone(tz, quiet) {
+            const status = document.getElementById('timezone-status');
+            return fetch('/api/preferences', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ timezone: tz })
+            }).then(function(res) {
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                if (!quiet) window.location.reload();
+            }).catch(function(err) {
+                if (status) status.textContent = 'Zona horaria no válida';
+                console.log('❌ Error saving timezone:', err);
+            });
+        }
+        if (!USER_TIMEZONE && window.Intl) {
+            try {
+                const browserTZ = Intl.DateTimeFormat().resolvedOptions().timeZone;
+                if (browserTZ) saveTimezone(browserTZ, true);
+            } catch(e) {}
+        }
+
+        // Estado de salud de las suscripciones (pestaña CONFIG)
+        async function refreshFeedHealth() {
+            const host = document.getElementById('feed-health');
+            if (!host) return;
+            try {
+                const res = await fetch('/api/feeds/health');
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                const feeds = await res.json();
+                const broken = feeds.filter(f => f.status === 'failing').length;
+                const summary = document.getElementById('feed-health-summary');
+                if (summary) summary.textContent = feeds.length + ' feeds, ' + broken + ' con errores';
+                host.innerHTML = feeds.map(f => {
+                    const label = { ok: '[ OK ]', failing: '[FAIL]', pending: '[....]', inactive: '[ -- ]' }[f.status] || '[ ?? ]';
+                    const when = f.last_success ? new Date(f.last_success).toLocaleString() : 'nunca';
+                    let html = '<div class="feed-health-line" title="' + escapeHTML(f.url) + '">'
+                             + '<span class="health-' + escapeHTML(f.status) + '">' + label + '</span> '
+                             + '<input type="number" class="feed-max-items" min="0" max="500" title="Máximo de artículos en el río"'
+                             + ' data-url="' + escapeHTML(f.url) + '" value="' + escapeHTML(f.max_items) + '"> '
+                             + '<input type="text" class="feed-setting feed-name" placeholder="nombre" title="Nombre personalizado"'
+                             + ' data-url="' + escapeHTML(f.url) + '" value="' + escapeHTML(f.custom_name || '') + '"> '
+                             + '<input type="text" class="feed-setting feed-category" placeholder="categoría" title="Categoría"'
+                             + ' data-url="' + escapeHTML(f.url) + '" value="' + escapeHTML(f.category || '') + '"> '
+                             + (f.favicon_url ? '<img class="feed-favicon" src="' + escapeHTML(f.favicon_url) + '" alt="" onerror="this.remove()"> ' : '')
+                             + escapeHTML(f.name || f.url)
+                             + ' <span style="color:#888;">(último OK: ' + escapeHTML(when) + ')</span>'
+                             + '</div>';
+                    if (f.status === 'failing') {
+                        html += '<div class="feed-health-error">'
+                              + escapeHTML(f.consecutive_failures + ' fallos seguidos'
+                                  + (f.http_status ? ' · HTTP ' + f.http_status : '')
+                                  + ' · ' + (f.last_error || ''))
+                              + '</div>';
+                    }
+                    return html;
+                }).join('');
+                host.querySelectorAll('.feed-max-items').forEach(input => {
+                    input.addEventListener('change', () => saveFeedSettings(input.dataset.url, { max_items: parseInt(input.value, 10) || 0 }));
+                });
+                host.querySelectorAll('.feed-name').forEach(input => {
+                    input.addEventListener('change', () => saveFeedSettings(input.dataset.url, { name: input.value }));
+                });
+                host.querySelectorAll('.feed-category').forEach(input => {
+                    input.addEventListener('change', () => saveFeedSettings(input.dataset.url, { category: input.value }));
+                });
+            } catch(e) {
+                console.error('refreshFeedHealth failed', e);
+                host.innerHTML = '<div class="feed-health-error">Error cargando estado de los feeds</div>';
+            }
+        }
+
+        // Reglas de filtrado (CONFIG): lista, alta, prueba y borrado
+        function ruleFromForm() {
+            return {
+                name: document.getElementById('rule-name').value,
+                field: document.getElementById('rule-field').value,
+                match: document.getElementById('rule-match').value,
+                pattern: document.getElementById('rule-pattern').value,
+                actions: Array.from(document.querySelectorAll('.rule-action:checked')).map(c => c.value),
+                tag: document.getElementById('rule-tag').value
+            };
+        }
+
+        async function refreshRules() {
+            const host = document.getElementById('rules-list');
+            if (!host) return;
+            try {
+                const res = await fetch('/api/rules');
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                const list = await res.json();
+                if (list.length === 0) {
+                    host.innerHTML = '<div style="color:#888;">Sin reglas.</div>';
+                    return;
+                }
+                host.innerHTML = list.map(r => '<div class="rule-line">'
+                    + '<span style="color:' + (r.enabled ? '#00ff00' : '#666') + ';">' + escapeHTML(r.name) + '</span> '
+                    + (r.enabled ? '' : '<span style="color:#666;">[DESACTIVADA]</span> ')
+                    + '<span style="color:#888;">' + escapeHTML(r.field + ' ~ ' + r.match + ' "' + r.pattern + '" → '
+                        + r.actions.map(a => a === 'tag' ? '#' + r.tag : a).join(', ')) + '</span> '
+                    + '<button class="action-button" data-id="' + escapeHTML(r.id) + '" data-op="toggle">' + (r.enabled ? '[DESACTIVAR]' : '[ACTIVAR]') + '</button> '
+                    + '<button class="action-button" data-id="' + escapeHTML(r.id) + '" data-op="test">[PROBAR]</button> '
+                    + '<button class="action-button" data-id="' + escapeHTML(r.id) + '" data-op="delete">[BORRAR]</button>'
+                    + '</div>').join('');
+                host.querySelectorAll('button[data-op]').forEach(button => {
+                    button.addEventListener('click', () => {
+                        if (button.dataset.op === 'toggle') toggleRule(list.find(r => r.id === button.dataset.id));
+                        else if (button.dataset.op === 'test') dryRunRule(button.dataset.id);
+                        else deleteRule(button.dataset.id);
+                    });
+                });
+            } catch(e) {
+                console.error('refreshRules failed', e);
+                host.innerHTML = '<div class="feed-health-error">Error cargando las reglas</div>';
+            }
+        }
+
+        async function saveRule() {
+            const out = document.getElementById('rule-result');
+            const res = await fetch('/api/rules', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(ruleFromForm())
+            });
+            if (!res.ok) {
+                out.innerHTML = '<span class="feed-health-error">❌ ' + escapeHTML((await res.text()).trim()) + '</span>';
+                return;
+            }
+            out.textContent = '✅ Regla guardada';
+            document.getElementById('rule-pattern').value = '';
+            document.getElementById('rule-name').value = '';
+            refreshRules();
+        }
+
+        async function dryRunRule(id) {
+            const out = document.getElementById('rule-result');
+            const res = await fetch('/api/rules/dry-run', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(id ? { id: id } : ruleFromForm())
+            });
+            if (!res.ok) {
+                out.innerHTML = '<span class="feed-health-error">❌ ' + escapeHTML((await res.text()).trim()) + '</span>';
+                return;
+            }
+            const data = await res.json();
+            out.innerHTML = '<div style="color:#888;">' + escapeHTML(data.rule.name || data.rule.pattern) + ': '
+                + data.count + ' de ' + data.checked + ' artículos</div>'
+                + data.matches.slice(0, 50).map(m => '<div>· <span class="source-name">' + escapeHTML(m.source) + '</span> '
+                    + '<a href="' + escapeHTML(m.link) + '" target="_blank" rel="noopener noreferrer">' + escapeHTML(m.title) + '</a></div>').join('');
+        }
+
+        async function toggleRule(rule) {
+            const res = await fetch('/api/rules', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(Object.assign({}, rule, { enabled: !rule.enabled }))
+            });
+            if (!res.ok) {
+                document.getElementById('rule-result').innerHTML = '<span class="feed-health-error">❌ ' + escapeHTML((await res.text()).trim()) + '</span>';
+                return;
+            }
+            refreshRules();
+        }
+
+        async function deleteRule(id) {
+            if (!confirm('¿Borrar la regla?')) return;
+            await fetch('/api/rules?id=' + encodeURIComponent(id), { method: 'DELETE' });
+            refreshRules();
+        }
+
+        // Alta de feeds con autodescubrimiento: si la web tiene varios feeds se
+        // listan para elegir uno
+        async function addFeed(url) {
+            const result = document.getElementById('add-feed-result');
+            if (!url || !result) return;
+            result.textContent = '⏳ Buscando feeds...';
+            const body = new URLSearchParams({ url: url, category: document.getElementById('add-feed-category').value });
+            try {
+                const res = await fetch('/add', { method: 'POST', body: body });
+                const text = await res.text();
+                let data = null;
+                try { data = JSON.parse(text); } catch(e) {}
+                if (!data) { result.textContent = '❌ ' + text; return; }
+                if (data.status === 'choose') {
+                    result.innerHTML = 'Se encontraron varios feeds:' + data.feeds.map(f =>
+                        '<div class="feed-health-line"><a href="#" class="action-link add-feed-choice" data-url="' + escapeHTML(f.url) + '">[+]</a> '
+                        + escapeHTML(f.info.title || f.url) + ' <span style="color:#888;">' + escapeHTML(f.url) + '</span></div>').join('');
+                    result.querySelectorAll('.add-feed-choice').forEach(a => {
+                        a.addEventListener('click', ev => { ev.preventDefault(); addFeed(a.dataset.url); });
+                    });
+                } else if (data.status === 'exists') {
+                    result.textContent = 'ℹ️ Ya estás suscrito a ' + (data.feed.title || data.feed.url);
+                } else {
+                    result.textContent = '✅ Suscrito a ' + (data.feed.title || data.feed.url);
+                    refreshFeedHealth();
+                }
+            } catch(e) {
+                result.textContent = '❌ Error añadiendo el feed';
+            }
+        }
+
+        // Ajustes de una suscripción: máximo de artículos, nombre y categoría
+        function saveFeedSettings(url, settings) {
+            fetch('/api/feeds/settings', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(Object.assign({ url: url }, settings))
+            }).then(res => {
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                console.log('⚙️ Feed settings updated for', url);
+            }).catch(err => console.log('❌ Error saving feed settings:', err));
+        }
+
+        // Salta al feed o categoría siguiente (delta 1) o anterior (-1) según
+        // las opciones de la barra de filtros. Más allá del último vuelve al río
+        // completo.
+        function jumpRiverFilter(name, delta) {
+            const select = document.querySelector('#river-filter select[name="' + name + '"]');
+            if (!select || select.options.length < 2) return;
+            const count = select.options.length;
+            const index = (select.selectedIndex + delta + count) % count;
+            const params = new URLSearchParams(window.location.search);
+            params.delete('feed');
+            params.delete('category');
+            const value = select.options[index].value;
+            if (value) params.set(name, value);
+            const query = params.toString();
+            window.location.href = '/' + (query ? '?' + query : '');
+        }
+
+        // Paginación del río: cada página se pide con el cursor de la anterior
+        // y se añade al final de la lista (scroll infinito o J en el último)
+        let loadingMore = false;
+        async function loadMoreArticles() {
+            const more = document.getElementById('river-more');
+            if (!more || loadingMore) return false;
+            loadingMore = true;
+            more.textContent = '⏳ Cargando más artículos...';
+            try {
+                // Mismos filtros que la página actual
+                const params = new URLSearchParams(window.location.search);
+                params.set('cursor', more.dataset.cursor);
+                params.set('format', 'html');
+                const res = await fetch('/api/articles?' + params.toString());
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                const data = await res.json();
+                more.insertAdjacentHTML('beforebegin', data.html);
+                applyReadState();
+                const position = currentPosition;
+                initializeArticlesList();
+                currentPosition = Math.min(position, allArticles.length - 1);
+                highlightCurrentArticle();
+                if (data.next_cursor) {
+                    more.dataset.cursor = data.next_cursor;
+                    more.textContent = '[J] para cargar más artículos...';
+                } else {
+                    more.remove();
+                }
+                console.log('📥 Loaded ' + data.count + ' more articles');
+                return data.count > 0;
+            } catch(e) {
+                console.error('loadMoreArticles failed', e);
+                more.textContent = 'Error cargando más artículos';
+                return false;
+            } finally {
+                loadingMore = false;
+            }
+        }
+        window.addEventListener('scroll', () => {
+            const feedsTab = document.getElementById('feeds-tab');
+            if (!feedsTab || !feedsTab.classList.contains('active')) return;
+            if (window.innerHeight + window.scrollY >= document.documentElement.scrollHeight - 300) {
+                loadMoreArticles();
+            }
+        });
+
         // 🔄 LiveReload por SSE (solo desarrollo). Si el servidor reinicia, el stream se corta y re-conecta => recarga.
         (function(){
             if (!('EventSource' in window)) return;
@@ -1119,6 +1991,22 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             loadingIndicator.style.display = 'block';
             
             try {
+                // Los artículos de SAVED/LOVED con copia offline se leen de ella
+                if (contentElement.dataset.archived) {
+                    const archived = await fetch('/api/archive?url=' + encodeURIComponent(articleUrl));
+                    if (archived.ok) {
+                        const snapshot = await archived.json();
+                        loadingIndicator.style.display = 'none';
+                        descriptionDiv.style.display = 'none';
+                        fullContentDiv.innerHTML = '<div class="archive-note">📦 Copia offline del '
+                            + escapeHTML(new Date(snapshot.fetched_at).toLocaleString())
+                            + ' · <a href="' + escapeHTML(snapshot.url) + '" target="_blank">→ original</a></div>'
+                            + snapshot.content;
+                        fullContentDiv.style.display = 'block';
+                        return;
+                    }
+                }
+
                 const response = await fetch('/api/scrape-article', {
                     method: 'POST',
                     headers: {
@@ -1136,48 +2024,9 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 // Hide loading indicator
                 loadingIndicator.style.display = 'none';
                 
-                // Process and format the content
-                let formattedContent = data.content;
-                
-                // Basic formatting improvements
-                if (formattedContent) {
-                    // Remove extra whitespace and normalize
-                    formattedContent = formattedContent
-                        .trim()
-                        .replace(/\s+/g, ' ')
-                        .replace(/\n+/g, '\n');
-                    
-                    // Split into sentences and create proper paragraphs
-                    let sentences = formattedContent.split(/(?<=[.!?])\s+(?=[A-Z])/);
-                    
-                    // Group sentences into paragraphs (every 3-4 sentences)
-                    let paragraphs = [];
-                    let currentParagraph = [];
-                    
-                    sentences.forEach((sentence, index) => {
-                        currentParagraph.push(sentence.trim());
-                        
-                        // Create new paragraph every 3-4 sentences or at natural breaks
-                        if (currentParagraph.length >= 3 || 
-                            sentence.includes('"') || 
-                            sentence.length > 200 ||
-                            (index === sentences.length - 1)) {
-                            
-                            paragraphs.push(currentParagraph.join(' '));
-                            currentParagraph = [];
-                        }
-                    });
-                    
-                    // Join paragraphs with proper HTML formatting
-                    formattedContent = paragraphs
-                        .filter(p => p.trim().length > 0)
-                        .map(p => '<p>' + p.trim() + '</p>')
-                        .join('');
-                }
-                
                 // Hide description and show full content
                 descriptionDiv.style.display = 'none';
-                fullContentDiv.innerHTML = formattedContent || data.content;
+                fullContentDiv.innerHTML = data.content; // HTML ya saneado en el servidor
                 fullContentDiv.style.display = 'block';
                 
             } catch (error) {
@@ -1256,6 +2105,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 // Si estaba abierto, marcarlo como leído al navegar
                 if (wasCurrentArticleOpen) {
                     currentLine.classList.add('read');
+                    persistRead(currentLine.dataset.url, currentLine.dataset.id);
                     console.log('📖 Marking as read:', currentArticle.title.substring(0, 30) + '...');
                 }
             }
@@ -1290,7 +2140,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                         const newLine = newArticle.element.querySelector('.article-line');
                         if (newLine && newLine.dataset && newLine.dataset.url) {
                             newLine.classList.add('read');
-                            persistRead(newLine.dataset.url);
+                            persistRead(newLine.dataset.url, newLine.dataset.id);
                         }
                 }, 10);
             }
@@ -1302,6 +2152,90 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             return true;
         }
 
+        function currentArticleLine() {
+            const current = allArticles[currentPosition];
+            return current ? current.element.querySelector('.article-line') : null;
+        }
+
+        function markCurrentUnread() {
+            const line = currentArticleLine();
+            if (!line) return;
+            line.classList.remove('read');
+            readArticles.delete(line.dataset.url);
+            saveReadSet();
+            if (line.dataset.id) markArticles('unread', [line.dataset.id]);
+        }
+
+        function toggleCurrentStar() {
+            const line = currentArticleLine();
+            if (!line || !line.dataset.id) return;
+            const starred = !line.classList.contains('starred');
+            line.classList.toggle('starred', starred);
+            fetch('/api/articles/star', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: line.dataset.id, starred: starred })
+            }).catch(function(err) { console.log('❌ Error starring article:', err); });
+        }
+
+        function saveSmartFeed(query) {
+            query = (query || '').trim();
+            if (!query) return;
+            const name = prompt('Nombre del smart feed:', query);
+            if (name === null) return;
+            fetch('/api/smart-feeds', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ name: name, query: query })
+            }).then(async function(res) {
+                if (!res.ok) throw new Error((await res.text()).trim());
+                const smart = await res.json();
+                window.location.href = '/?smart=' + encodeURIComponent(smart.id);
+            }).catch(function(err) { alert('❌ ' + err.message); });
+        }
+
+        // Los no leídos de cada smart feed se cuentan aparte para no retrasar
+        // la carga de la página
+        async function refreshSmartCounts() {
+            try {
+                const res = await fetch('/api/smart-feeds');
+                if (!res.ok) throw new Error('HTTP ' + res.status);
+                const list = await res.json();
+                let total = 0;
+                list.forEach(smart => {
+                    total += smart.unread;
+                    document.querySelectorAll('.smart-unread').forEach(el => {
+                        if (el.dataset.id === smart.id) el.textContent = String(smart.unread);
+                    });
+                });
+                const cSmart = document.getElementById('count-smart');
+                if (cSmart) cSmart.textContent = String(total);
+            } catch(e) {
+                console.error('refreshSmartCounts failed', e);
+            }
+        }
+
+        function deleteSmartFeed(id, name) {
+            if (!confirm('¿Borrar el smart feed "' + name + '"?')) return;
+            fetch('/api/smart-feeds?id=' + encodeURIComponent(id), { method: 'DELETE' })
+                .then(function() { window.location.reload(); })
+                .catch(function(err) { console.log('❌ Error deleting smart feed:', err); });
+        }
+
+        function markAllRead() {
+            if (!confirm('¿Marcar todos los artículos como leídos?')) return;
+            // Viendo un smart feed sólo se marcan sus artículos
+            const smart = new URLSearchParams(window.location.search).get('smart');
+            const options = { method: 'POST' };
+            if (smart) {
+                options.headers = { 'Content-Type': 'application/json' };
+                options.body = JSON.stringify({ smart: smart });
+            }
+            fetch('/api/articles/read-all', options)
+                .then(function() { window.location.reload(); })
+                .catch(function(err) { console.log('❌ Error marking all read:', err); });
+        }
+
         function toggleCurrentArticle() {
             // FUNCIÓN: Abre/cierra el artículo actual sin cambiar la posición
             // - Si está cerrado -> lo abre
@@ -1319,7 +2253,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                     content.classList.remove('expanded');
                     content.style.display = 'none';
                     line.classList.add('read');
-                    if (line && line.dataset && line.dataset.url) persistRead(line.dataset.url);
+                    if (line && line.dataset && line.dataset.url) persistRead(line.dataset.url, line.dataset.id);
                     console.log('📖 Article closed and marked as read: ' + currentArticle.title.substring(0, 30) + '...');
                 } else {
                     // Si no está expandido, lo abre
@@ -1401,12 +2335,14 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 function renderItem(i){
                     const url = (i.link||'');
                     const readCls = (readArticles && readArticles.has && readArticles.has(url)) ? ' read' : '';
+                    const archived = i.archived_at ? ' data-archived="1"' : '';
                     return '<div class="article-container">'
                          + '<div class="article-line'+readCls+'" data-url="'+url+'">'
                          + '<span class="source-name">'+(i.source||'')+'</span>&nbsp;'
                          + '<span class="title">'+(i.title||'')+'</span>'
+                         + (i.archived_at ? '&nbsp;<span class="archived-mark" title="Copia offline guardada">[OFFLINE]</span>' : '')
                          + '</div>'
-                         + '<div class="article-content" data-article-url="'+url+'">'
+                         + '<div class="article-content" data-article-url="'+url+'"'+archived+'>'
                          +   '<div style="height: 15px;"></div>'
                          +   '<div class="article-title-full" style="color: #ffffff; font-weight: 400; font-size: 16px; margin-bottom: 15px; line-height: 1.3;">'+(i.title||'')+'</div>'
                          +   '<div class="article-description"></div>'
@@ -1568,22 +2504,71 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 const si = document.getElementById('search-input');
                 const host = document.getElementById('search-results');
                 if (si && host) {
-                    const doSearch = () => {
-                        const q = si.value.trim().toLowerCase();
+                    // Búsqueda en el servidor sobre todo lo descargado y archivado;
+                    // "más resultados" pide la página siguiente con offset
+                    const renderResult = (r) => {
+                        const url = escapeHTML(r.link);
+                        const date = r.published && !r.published.startsWith('0001') ? new Date(r.published).toLocaleDateString() : '';
+                        return '<div class="article-container">'
+                             + '<div class="article-line" data-url="' + url + '">'
+                             + '<span class="source-name">' + escapeHTML(r.source) + '</span>&nbsp;'
+                             + '<span class="title">' + escapeHTML(r.title || r.link) + '</span>'
+                             + (r.type === 'saved' ? '&nbsp;<span class="archived-mark">[SAVED]</span>' : '')
+                             + (date ? '&nbsp;<span class="search-date">' + date + '</span>' : '')
+                             + '</div>'
+                             + '<div class="search-snippet">' + (r.snippet || '') + '</div>'
+                             + '<div class="article-content" data-article-url="' + url + '">'
+                             +   '<div style="height: 15px;"></div>'
+                             +   '<div class="article-title-full" style="color: #ffffff; font-weight: 400; font-size: 16px; margin-bottom: 15px; line-height: 1.3;">' + escapeHTML(r.title) + '</div>'
+                             +   '<div class="article-description"></div>'
+                             +   '<div class="article-full-content" style="display: none;"></div>'
+                             +   '<div class="loading-indicator" style="display: none; color: #00ff00; margin: 10px 0;">⏳ Cargando contenido completo...</div>'
+                             + '</div>'
+                             + '</div>';
+                    };
+                    const doSearch = async (offset) => {
+                        const q = si.value.trim();
                         if (!q) { host.innerHTML = ''; return; }
-                        const results = allArticles.filter(a => a.searchText.includes(q));
-                        host.innerHTML = results.map(r => {
-                            const line = r.element.querySelector('.article-line').outerHTML;
-                            return '<div class="article-container">' + line + '</div>';
-                        }).join('');
+                        host.querySelector('.search-more')?.remove();
+                        try {
+                            const resp = await fetch('/api/search?q=' + encodeURIComponent(q) + '&offset=' + (offset || 0));
+                            if (!resp.ok) {
+                                host.innerHTML = '<div class="info">❌ ' + escapeHTML((await resp.text()).trim()) + '</div>';
+                                return;
+                            }
+                            const data = await resp.json();
+                            const html = data.results.map(renderResult).join('');
+                            if (!offset) {
+                                host.innerHTML = '<div class="info">' + data.total + ' resultado(s)</div>' + html;
+                            } else {
+                                host.insertAdjacentHTML('beforeend', html);
+                            }
+                            if (data.next_offset) {
+                                host.insertAdjacentHTML('beforeend', '<div class="search-more info" style="cursor: pointer;">[más resultados]</div>');
+                                host.querySelector('.search-more').onclick = () => doSearch(data.next_offset);
+                            }
+                            initializeArticlesList();
+                            highlightCurrentArticle();
+                            setupArticleInteractionHandlers();
+                        } catch (e) {
+                            console.error('search failed', e);
+                        }
                     };
                     si.onkeydown = (ev) => {
                         if (ev.key === 'Escape') { si.value = ''; host.innerHTML = ''; }
-                        if (ev.key === 'Enter') { ev.preventDefault(); doSearch(); }
+                        if (ev.key === 'Enter') { ev.preventDefault(); doSearch(0); }
                     };
                 }
             }
 
+            if (tabName === 'config') {
+                refreshFeedHealth();
+                refreshRules();
+            }
+            if (tabName === 'smart') {
+                refreshSmartCounts();
+            }
+
             // Si es SAVED o LOVED, refrescar listas antes de reindexar
             // Al cambiar de pestaña, refrescar y luego reindexar
             if (tabName === 'favorites' || tabName === 'saved') {
@@ -1727,7 +2712,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             // Configurar event listeners de tabs
             document.querySelectorAll('.tab').forEach((tab, index) => {
                 tab.addEventListener('click', () => {
-                    const tabNames = ['feeds', 'search', 'favorites', 'saved', 'config'];
+                    const tabNames = ['feeds', 'search', 'favorites', 'saved', 'smart', 'config'];
                     switchTab(tabNames[index]);
                 });
             });
@@ -1749,6 +2734,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             if (typeof refreshLists === 'function') {
                 refreshLists();
             }
+            refreshSmartCounts();
             
             // ==========================================================================================================
             // 🎹 CONFIGURACIÓN DE TECLAS - SISTEMA DE NAVEGACIÓN COMPLETO
@@ -1771,7 +2757,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 const key = (e.key || '').toLowerCase();
 
                 // Manejo de F1..F5 siempre, para evitar que el navegador capture F1
-                if (key === 'f1' || key === 'f2' || key === 'f3' || key === 'f4' || key === 'f5') {
+                if (key === 'f1' || key === 'f2' || key === 'f3' || key === 'f4' || key === 'f5' || key === 'f6') {
                     e.preventDefault();
                     if (key === 'f1') switchTab('feeds');
                     if (key === 'f2') { 
@@ -1782,6 +2768,17 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                     if (key === 'f3') { switchTab('favorites'); refreshLists(); }
                     if (key === 'f4') { switchTab('saved'); refreshLists(); }
                     if (key === 'f5') switchTab('config');
+                    if (key === 'f6') switchTab('smart');
+                    return;
+                }
+
+                // Filtros del río: N/P feed siguiente/anterior, Shift+N/Shift+P
+                // categoría siguiente/anterior, X quitar filtros. Funcionan aunque
+                // el filtro actual no tenga artículos.
+                if (key === 'n' || key === 'p' || key === 'x') {
+                    e.preventDefault();
+                    if (key === 'x') { window.location.href = '/'; return; }
+                    jumpRiverFilter(e.shiftKey ? 'category' : 'feed', key === 'n' ? 1 : -1);
                     return;
                 }
 
@@ -1851,6 +2848,12 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                         
                         if (nextPos < allArticles.length && navigateToPosition(nextPos)) {
                             console.log('📄 Navigated to article', nextPos + 1, 'of', allArticles.length);
+                        } else if (document.getElementById('river-more')) {
+                            // J pasado el final: cargar la página siguiente y seguir
+                            isNavigating = false;
+                            loadMoreArticles().then(loaded => {
+                                if (loaded && nextPos < allArticles.length) navigateToPosition(nextPos);
+                            });
                         } else {
                             console.log('🔚 Already at last article');
                             isNavigating = false;
@@ -1907,6 +2910,23 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                         saveCurrent('loved');
                         break;
                     
+                    case 'u':
+                        e.preventDefault();
+                        console.log('📭 U pressed - mark current unread');
+                        markCurrentUnread();
+                        break;
+                    case 'f':
+                        e.preventDefault();
+                        console.log('⭐ F pressed - toggle star');
+                        toggleCurrentStar();
+                        break;
+                    case 'a':
+                        if (!e.shiftKey) break;
+                        e.preventDefault();
+                        console.log('📚 Shift+A pressed - mark all read');
+                        markAllRead();
+                        break;
+                    
                     case 'escape':
                         e.preventDefault();
                         console.log('🚪 Escape pressed - closing all articles');
@@ -1934,7 +2954,7 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
             <!-- Tab Navigation -->
             <div class="tabs">
                 <div class="tab tab-active" data-tab="feeds">
-                    FEEDS [` + strconv.Itoa(len(data.Articles)) + `] <span class="tab-shortcut">[F1]</span>
+                    FEEDS [` + strconv.Itoa(data.Total) + `] <span class="tab-shortcut">[F1]</span>
                 </div>
                 <div class="tab" data-tab="search">
                     SEARCH <span class="tab-shortcut">[F2]</span>
@@ -1945,6 +2965,9 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 <div class="tab" data-tab="saved">
                     LOVED [<span id="count-loved">0</span>] <span class="tab-shortcut">[F4]</span>
                 </div>
+                <div class="tab" data-tab="smart">
+                    SMART [<span id="count-smart">0</span>] <span class="tab-shortcut">[F6]</span>
+                </div>
                 <div class="tab" data-tab="config">
                     CONFIG <span class="tab-shortcut">[F5]</span>
                 </div>
@@ -1957,36 +2980,14 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
         <div class="content-wrapper">
         
         <!-- Tab Content -->
-        <div id="feeds-tab" class="tab-content active">`
+        <div id="feeds-tab" class="tab-content active">` + renderRiverFilterBar(data, location)
 
 	for _, article := range data.Articles {
-		html += fmt.Sprintf(`
-        <div class="article-container">
-            <div class="article-line" data-url="%s">
-                <span class="source-name">%s</span>&nbsp;
-                <span class="title">%s</span>
-            </div>
-            <div class="article-content" data-article-url="%s">
-                <div style="height: 15px;"></div>
-                <div class="article-title-full" style="color: #ffffff; font-weight: 400; font-size: 16px; margin-bottom: 15px; line-height: 1.3;">%s</div>
-                <div class="article-description">%s</div>
-            <div class="article-actions" style="margin-top:8px;">
-                    <a href="#" class="action-link" onclick="event.preventDefault(); saveToList('loved', this)">LOVE [L]</a>
-                    <span style="margin:0 8px; color:#333;">|</span>
-                    <a href="#" class="action-link" onclick="event.preventDefault(); saveToList('saved', this)">SAVE [S]</a>
-                    <span style="margin:0 8px; color:#333;">|</span>
-                    <a href="#" class="action-link" onclick="event.preventDefault(); shareArticle(this)">SHARE</a>
-                </div>
-                <div class="article-full-content" style="display: none;"></div>
-                <div class="loading-indicator" style="display: none; color: #00ff00; margin: 10px 0;">⏳ Cargando contenido completo...</div>
-            </div>
-        </div>`,
-			article.Link,
-			article.Source,
-			article.Title,
-			article.Link,  // data-article-url for JS
-			article.Title, // Título completo en blanco
-			article.Description)
+		html += renderArticleItem(article, location)
+	}
+	if data.NextCursor != "" {
+		html += `
+        <div id="river-more" data-cursor="` + data.NextCursor + `" style="color:#888; padding:10px 0;">[J] para cargar más artículos...</div>`
 	}
 
 	html += `
@@ -2013,11 +3014,19 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
         <!-- Search Tab -->
         <div id="search-tab" class="tab-content">
             <div class="page-header">SEARCH</div>
-            <div class="info">Busca por título o fuente. Presiona Enter para filtrar, ESC para limpiar.</div>
+            <div class="info">Busca en el texto de todos los artículos descargados y guardados. Presiona Enter para buscar, ESC para limpiar.<br>
+                "frase exacta" · a OR b · -excluir · source:fuente · after:2024-01-31 · before:2024-12-31</div>
             <input id="search-input" class="config-input" placeholder="Buscar..." style="width: 100%; max-width: 720px;"/>
+            <button class="action-button" onclick="saveSmartFeed(document.getElementById('search-input').value)">[GUARDAR COMO SMART FEED]</button>
             <div id="search-results"></div>
         </div>
 
+        <!-- Smart Feeds Tab -->
+        <div id="smart-tab" class="tab-content">
+            <div class="page-header">SMART FEEDS</div>
+            <div class="info">Búsquedas guardadas que se leen como un feed: los artículos del río que las cumplen. Se crean desde SEARCH; el [RSS] sirve para suscribirse desde otro lector.</div>` + renderSmartFeeds(data.SmartFeeds) + `
+        </div>
+
         <!-- Config Tab -->
         <div id="config-tab" class="tab-content">
             <div class="page-header">CONFIGURACIÓN</div>
@@ -2026,8 +3035,61 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
                 <p><strong>F1:</strong> Feeds | <strong>F2:</strong> Saved | <strong>F3:</strong> Loved | <strong>F4:</strong> Config</p>
                 <p><strong>J/K o ↑/↓:</strong> Navegar artículos</p>
                 <p><strong>Space/Enter:</strong> Expandir artículo</p>
+                <p><strong>U:</strong> Marcar como no leído | <strong>F:</strong> Destacar | <strong>Shift+A:</strong> Marcar todo como leído</p>
+                <p><strong>N/P:</strong> Feed siguiente/anterior | <strong>Shift+N/Shift+P:</strong> Categoría siguiente/anterior | <strong>X:</strong> Quitar filtros</p>
                 <p><strong>ESC:</strong> Cerrar artículos</p>
             </div>
+            <div class="config-section">
+                <h3>Zona horaria</h3>
+                <p>Las fechas de los artículos se muestran en: <strong id="timezone-current">` + location.String() + `</strong></p>
+                <input type="text" id="timezone-input" class="search-input" placeholder="Europe/Madrid" value="` + data.Timezone + `" style="width:240px;">
+                <button class="action-button" onclick="saveTimezone(document.getElementById('timezone-input').value)">[GUARDAR]</button>
+                <span id="timezone-status" style="color:#888;"></span>
+            </div>
+            <div class="config-section">
+                <h3>Añadir feed</h3>
+                <p style="color:#888;">URL del feed o de la web (se buscan sus feeds automáticamente), o también: @canal de YouTube, r/subreddit, @usuario@instancia de Mastodon, github.com/dueño/repo</p>
+                <input type="text" id="add-feed-url" class="search-input" placeholder="https://ejemplo.com" style="width:320px;">
+                <input type="text" id="add-feed-category" class="search-input" placeholder="categoría" style="width:140px;">
+                <button class="action-button" onclick="addFeed(document.getElementById('add-feed-url').value)">[AÑADIR]</button>
+                <div id="add-feed-result" style="margin-top:6px;"></div>
+            </div>
+            <div class="config-section">
+                <h3>Estado de los feeds</h3>
+                <p id="feed-health-summary"></p>
+                <div id="feed-health"></div>
+            </div>
+            <div class="config-section">
+                <h3>Reglas</h3>
+                <p style="color:#888;">Se aplican a los artículos nuevos al descargarlos. Palabras clave separadas por comas (basta una) o expresión regular; sin distinguir mayúsculas.</p>
+                <div id="rules-list"></div>
+                <div id="rule-form" style="margin-top:8px;">
+                    <input type="text" id="rule-name" class="search-input" placeholder="nombre" style="width:120px;">
+                    <select id="rule-field">
+                        <option value="any">cualquier campo</option>
+                        <option value="title">título</option>
+                        <option value="description">descripción</option>
+                        <option value="source">fuente</option>
+                        <option value="author">autor</option>
+                    </select>
+                    <select id="rule-match">
+                        <option value="keywords">palabras clave</option>
+                        <option value="regex">regex</option>
+                    </select>
+                    <input type="text" id="rule-pattern" class="search-input" placeholder="patrocinado, sponsored" style="width:220px;">
+                    <br>
+                    <label><input type="checkbox" class="rule-action" value="hide"> silenciar</label>
+                    <label><input type="checkbox" class="rule-action" value="read"> marcar leído</label>
+                    <label><input type="checkbox" class="rule-action" value="save"> SAVE</label>
+                    <label><input type="checkbox" class="rule-action" value="love"> LOVE</label>
+                    <label><input type="checkbox" class="rule-action" value="priority"> prioritario</label>
+                    <label><input type="checkbox" class="rule-action" value="tag"> etiqueta</label>
+                    <input type="text" id="rule-tag" class="search-input" placeholder="etiqueta" style="width:100px;">
+                    <button class="action-button" onclick="dryRunRule()">[PROBAR]</button>
+                    <button class="action-button" onclick="saveRule()">[GUARDAR]</button>
+                    <div id="rule-result" style="margin-top:6px;"></div>
+                </div>
+            </div>
             <div class="config-section">
                 <h3>Información del sistema</h3>
                 <p>Servidor: LIBERTARIAN 2.0</p>
@@ -2046,84 +3108,326 @@ func renderHomePage(w http.ResponseWriter, data TemplateData) {
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	username := getUserFromRequest(r)
+	timezone, location := userLocation(username)
+
+	// En la página los filtros mal escritos se ignoran en lugar de dar error
+	filter, err := parseRiverFilter(r.URL.Query(), location)
+	if err != nil {
+		log.Printf("⚠️ Ignoring invalid river filter for %s: %v", username, err)
+	}
+
+	allArticles := riverArticles(username, filter)
+	page, nextCursor := paginateRiver(allArticles, "", RIVER_PAGE_SIZE)
+
+	// Precargar contenido completo de los primeros artículos en segundo plano
+	go preloadArticleContent(page)
+
+	data := TemplateData{
+		Articles:   page,
+		Timezone:   timezone,
+		Location:   location,
+		Total:      len(allArticles),
+		NextCursor: nextCursor,
+		Feeds:      loadFeedsForUser(username),
+		Filter:     filter,
+		SmartFeeds: smartFeedList(username),
+	}
+
+	log.Printf("📊 Final article count being sent to template: %d of %d", len(page), len(allArticles))
+	if len(page) > 0 {
+		log.Printf("📰 First article: %s - %s", page[0].Title, page[0].Source)
+	} else {
+		log.Printf("❌ NO ARTICLES TO DISPLAY!")
+	}
+
+	elapsed := time.Since(startTime)
+	log.Printf("⚡ Home handler completed in %v with %d articles (STORED)", elapsed, len(page))
+	renderHomePage(w, data)
+}
+
+// riverFilter restringe el río. Los campos vacíos no filtran.
+type riverFilter struct {
+	Feed     string    // URL de un único feed (aunque esté inactivo)
+	Category string    // Categoría, incluidas sus subcarpetas
+	Source   string    // Texto que debe contener el nombre de la fuente
+	ShowAll  bool      // Incluir también los artículos leídos
+	Since    time.Time // Publicados desde (inclusive)
+	Until    time.Time // Publicados antes de (exclusivo)
+	Episodes bool      // Sólo artículos con audio o vídeo adjunto
+	Smart    string    // ID de una búsqueda guardada que deben cumplir
+	Tag      string    // Etiqueta puesta por una regla
+	Priority bool      // Sólo los marcados como prioritarios por una regla
+	Muted    bool      // Incluir también los silenciados por una regla
+}
+
+// parseRiverFilter lee los filtros de la query: feed, category, source,
+// unread=0 (o el antiguo show=all), episodes=1, smart, tag, priority=1,
+// muted=1, since y until. Las fechas aceptan
+// RFC3339 o AAAA-MM-DD en la zona del usuario; until con sólo fecha incluye
+// el día entero. Si hay un error se devuelve el filtro con lo que sí se pudo leer.
+func parseRiverFilter(query url.Values, location *time.Location) (riverFilter, error) {
+	filter := riverFilter{
+		Feed:     strings.TrimSpace(query.Get("feed")),
+		Category: strings.Trim(strings.TrimSpace(query.Get("category")), "/"),
+		Source:   strings.TrimSpace(query.Get("source")),
+		ShowAll:  query.Get("show") == "all" || query.Get("unread") == "0",
+		Episodes: query.Get("episodes") == "1",
+		Smart:    strings.TrimSpace(query.Get("smart")),
+		Tag:      strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query.Get("tag")), "#")),
+		Priority: query.Get("priority") == "1",
+		Muted:    query.Get("muted") == "1",
+	}
+	var errs []error
+	parseDate := func(name string, endOfDay bool) time.Time {
+		value := strings.TrimSpace(query.Get(name))
+		if value == "" {
+			return time.Time{}
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q", name, value))
+			return time.Time{}
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+	filter.Since = parseDate("since", false)
+	filter.Until = parseDate("until", true)
+	return filter, errors.Join(errs...)
+}
+
+// includesFeed indica si los artículos del feed entran en el río filtrado
+func (f riverFilter) includesFeed(feed Feed) bool {
+	if f.Feed != "" {
+		return feed.URL == f.Feed
+	}
+	if !feed.Active {
+		return false
+	}
+	if f.Category != "" {
+		return feed.Category == f.Category || strings.HasPrefix(feed.Category, f.Category+"/")
+	}
+	return true
+}
+
+// includesArticle aplica los filtros por artículo (fuente, fechas, leídos,
+// episodios, marcas de las reglas)
+func (f riverFilter) includesArticle(a Article) bool {
+	if a.Read && !f.ShowAll {
+		return false
+	}
+	if a.Hidden && !f.Muted {
+		return false
+	}
+	if f.Priority && !a.Priority {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(a.Tags, f.Tag) {
+		return false
+	}
+	if f.Episodes && a.Episode() == nil {
+		return false
+	}
+	if f.Source != "" && !strings.Contains(strings.ToLower(a.Source), strings.ToLower(f.Source)) {
+		return false
+	}
+	t := a.SortTime()
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !t.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// riverArticles reúne el río de artículos del usuario: los últimos
+// MaxItems de cada feed que admite el filtro, con su estado
+// leído/destacado, ordenados del más reciente al más antiguo.
+func riverArticles(username string, filter riverFilter) []Article {
 	feeds := loadFeedsForUser(username)
-	log.Printf("🔍 Loading home for user: %s, feeds count: %d", username, len(feeds))
+	log.Printf("🔍 Loading river for user: %s, feeds count: %d", username, len(feeds))
 
+	// Los feeds los descarga el planificador en segundo plano; aquí sólo se
+	// leen los artículos ya guardados
 	var allArticles []Article
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
 	for _, feed := range feeds {
-		if !feed.Active {
-			log.Printf("⏭️ Skipping inactive feed: %s", feed.URL)
+		if !filter.includesFeed(feed) {
 			continue
 		}
-		log.Printf("📡 Processing active feed: %s", feed.URL)
-		wg.Add(1)
-		go func(feedURL string) {
-			defer wg.Done()
-			articles := getCachedOrFetch(feedURL)
-			log.Printf("📰 Fetched %d articles from %s", len(articles), feedURL)
-			mu.Lock()
-			// Tomar sólo las 10 últimas por feed (asumimos orden descendente en getCachedOrFetch)
-			if len(articles) > 10 {
-				articles = articles[:10]
+		articles := loadStoredArticles(feed.URL)
+		// Tomar sólo los últimos de cada feed (asumimos orden descendente en el feed)
+		if limit := feedItemLimit(feed); len(articles) > limit {
+			articles = articles[:limit]
+		}
+		// Mostrar la fuente con el nombre que el usuario ve en sus feeds
+		if source := riverSourceName(feed); source != "" {
+			for i := range articles {
+				articles[i].Source = source
 			}
-			allArticles = append(allArticles, articles...)
-			mu.Unlock()
-		}(feed.URL)
+		}
+		allArticles = append(allArticles, articles...)
 	}
-	wg.Wait()
 
-	// Filtrar artículos que ya se mostraron en sesiones anteriores del usuario
-	if username == "" {
-		username = getUserFromRequest(r)
-	}
-	loaded := loadLoadedArticlesSet(username)
+	// Aplicar el estado leído/destacado del usuario
+	states := loadArticleStates(username, allArticles)
 	filtered := make([]Article, 0, len(allArticles))
 	for _, a := range allArticles {
-		if !loaded[a.Link] {
-			filtered = append(filtered, a)
-			loaded[a.Link] = true
+		state := states[a.ID]
+		a.Read = state.Read
+		a.Starred = state.Starred
+		a.Position = state.Position
+		a.Hidden, a.Priority, a.Tags = state.Hidden, state.Priority, state.Tags
+		if !filter.includesArticle(a) {
+			continue
 		}
+		a.IsFav = isArticleFavorite(a.Link)
+		filtered = append(filtered, a)
 	}
 	allArticles = filtered
-	// Persistir conjunto actualizado
-	saveLoadedArticlesSet(username, loaded)
-
-	log.Printf("📊 Total articles before processing: %d", len(allArticles))
-
-	for i := range allArticles {
-		allArticles[i].IsFav = isArticleFavorite(allArticles[i].Link)
+	if filter.Smart != "" {
+		allArticles = smartFeedArticles(username, filter.Smart, allArticles)
 	}
 
-	// Sort articles by date and title to ensure consistent order
+	// Ordenar por fecha (la más reciente primero) y por ID para que el orden
+	// sea total y los cursores de paginación estables
 	sort.Slice(allArticles, func(i, j int) bool {
-		if allArticles[i].Date == allArticles[j].Date {
-			return allArticles[i].Title < allArticles[j].Title
+		ti, tj := allArticles[i].SortTime(), allArticles[j].SortTime()
+		if ti.Equal(tj) {
+			return allArticles[i].ID < allArticles[j].ID
 		}
-		return allArticles[i].Date > allArticles[j].Date
+		return ti.After(tj)
 	})
+	return allArticles
+}
 
-	// Mostrar todos los últimos (no limitar a 50)
+// Nombre de fuente con el que el usuario ve los artículos de feed; vacío si
+// el feed no tiene nombre y se usa el que trae cada artículo
+func riverSourceName(feed Feed) string {
+	if feed.CustomName == "" && feed.Title == "" {
+		return ""
+	}
+	return shortSourceName(feed.DisplayName())
+}
 
-	// Precargar contenido completo de los primeros artículos en segundo plano
-	go preloadArticleContent(allArticles)
+// Acorta los nombres de fuente muy largos para la línea del río
+func shortSourceName(name string) string {
+	runes := []rune(name)
+	if len(runes) > 30 {
+		return string(runes[:27]) + "..."
+	}
+	return name
+}
 
-	data := TemplateData{
-		Articles: allArticles,
+// Número de artículos por feed que entran en el río
+func feedItemLimit(feed Feed) int {
+	if feed.MaxItems > 0 {
+		return feed.MaxItems
 	}
+	return DEFAULT_FEED_MAX_ITEMS
+}
 
-	log.Printf("📊 Final article count being sent to template: %d", len(allArticles))
-	if len(allArticles) > 0 {
-		log.Printf("📰 First article: %s - %s", allArticles[0].Title, allArticles[0].Source)
-	} else {
-		log.Printf("❌ NO ARTICLES TO DISPLAY!")
+// El cursor es la posición (fecha, ID) del último artículo de la página,
+// así que no se desplaza aunque lleguen artículos nuevos entre páginas.
+func encodeRiverCursor(a Article) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(a.SortTime().UnixNano(), 10) + ":" + a.ID))
+}
+
+func decodeRiverCursor(cursor string) (time.Time, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", false
 	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, "", false
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, n), id, true
+}
 
-	elapsed := time.Since(startTime)
-	log.Printf("⚡ Home handler completed in %v with %d articles (CACHE + PARALLEL)", elapsed, len(allArticles))
-	renderHomePage(w, data)
+// paginateRiver devuelve hasta limit artículos posteriores al cursor (todos
+// desde el principio si está vacío) y el cursor de la página siguiente, que
+// queda vacío al llegar al final.
+func paginateRiver(articles []Article, cursor string, limit int) ([]Article, string) {
+	start := 0
+	if cursor != "" {
+		if t, id, ok := decodeRiverCursor(cursor); ok {
+			start = sort.Search(len(articles), func(i int) bool {
+				at := articles[i].SortTime()
+				return at.Before(t) || (at.Equal(t) && articles[i].ID > id)
+			})
+		}
+	}
+	end := start + limit
+	if end >= len(articles) {
+		return articles[start:], ""
+	}
+	page := articles[start:end]
+	return page, encodeRiverCursor(page[len(page)-1])
+}
+
+// articlesAPIHandler sirve el río paginado: GET /api/articles?cursor=&limit=
+// más los filtros de parseRiverFilter. Con format=html devuelve el HTML de
+// los artículos en lugar de los datos, para el scroll infinito de la página
+// principal.
+func articlesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		if _, _, ok := decodeRiverCursor(cursor); !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := RIVER_PAGE_SIZE
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, RIVER_MAX_PAGE_SIZE)
+	}
+
+	username := getUserFromRequest(r)
+	_, location := userLocation(username)
+	filter, err := parseRiverFilter(query, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, nextCursor := paginateRiver(riverArticles(username, filter), cursor, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	if query.Get("format") == "html" {
+		var b strings.Builder
+		for _, article := range page {
+			b.WriteString(renderArticleItem(article, location))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"html":        b.String(),
+			"count":       len(page),
+			"next_cursor": nextCursor,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"articles":    page,
+		"next_cursor": nextCursor,
+	})
 }
 
 func preloadArticleContent(articles []Article) {
@@ -2138,236 +3442,756 @@ func preloadArticleContent(articles []Article) {
 	var wg sync.WaitGroup
 	for i := 0; i < maxArticles; i++ {
 		article := articles[i]
+		wg.Add(1)
+		go func(url string, title string) {
+			defer wg.Done()
 
-		// Verificar si ya está en cache
-		articleContentCache.mutex.RLock()
-		cached, exists := articleContentCache.articles[article.Link]
-		articleContentCache.mutex.RUnlock()
-
-		// Solo precargar si no existe en cache o es muy antiguo
-		if !exists || time.Since(cached.Timestamp) > 30*time.Minute {
-			wg.Add(1)
-			go func(url string, title string) {
-				defer wg.Done()
-
-				content, err := scrapeArticleContent(url)
-				success := err == nil
-
-				// Si el scraping falla, usar contenido vacío pero marcar como intentado
-				if !success {
-					content = ""
-				}
-
-				// Guardar en cache
-				articleContentCache.mutex.Lock()
-				articleContentCache.articles[url] = CachedArticleContent{
-					Content:   content,
-					Timestamp: time.Now(),
-					Success:   success,
-				}
-				articleContentCache.mutex.Unlock()
-
-				if success {
-					log.Printf("✅ Precargado: %s", title)
-				} else {
-					log.Printf("⚠️ Falló precarga: %s", title)
-				}
-			}(article.Link, article.Title)
-		}
+			// articleContent sólo descarga si no está en la caché, ha
+			// caducado o ya toca reintentar un fallo
+			_, cached, err := articleContent(url)
+			switch {
+			case cached:
+				// Ya estaba en la caché, o falló hace poco y aún no toca reintentar
+			case err != nil:
+				log.Printf("⚠️ Falló precarga: %s", title)
+			default:
+				log.Printf("✅ Precargado: %s", title)
+			}
+		}(article.Link, article.Title)
 	}
 	wg.Wait()
 	log.Printf("🎯 Precarga de contenido completada")
 }
 
-func fetchFeedArticles(feedURL string) []Article {
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		TLSHandshakeTimeout: 10 * time.Second,
+func loadStoredArticles(feedURL string) []Article {
+	articles, err := store.FeedArticles(feedURL)
+	if err != nil {
+		log.Printf("❌ Error loading stored articles for %s: %v", feedURL, err)
 	}
-
-	client := &http.Client{
-		Timeout:   30 * time.Second,
-		Transport: transport,
+	// Los artículos guardados antes de tener ID o fechas interpretadas los
+	// reciben al leerlos
+	for i := range articles {
+		if articles[i].ID == "" {
+			articles[i].ID = articleID(feedURL, "", articles[i].Link, articles[i].Title)
+		}
+		if articles[i].Published.IsZero() && articles[i].Date != "" {
+			articles[i].Published, _ = parseFeedTime(articles[i].Date)
+		}
+		articles[i].FeedURL = feedURL
 	}
+	return articles
+}
 
-	fp := gofeed.NewParser()
-	fp.Client = client
+// Formatos de fecha habituales en feeds que no reconoce gofeed, además del
+// "2006-01-02 15:04" con el que se guardaban antes los artículos
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+func parseFeedTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
 
-	log.Printf("🌐 Intentando acceder al feed: %s", feedURL)
-	feed, err := fp.ParseURLWithContext(feedURL, ctx)
-	if err != nil {
-		log.Printf("❌ Error al acceder al feed %s: %v", feedURL, err)
-		return []Article{}
+// feedItemTime devuelve la fecha ya interpretada por gofeed o, si no pudo,
+// la que se consiga parsear del texto original
+func feedItemTime(parsed *time.Time, raw string) time.Time {
+	if parsed != nil {
+		return parsed.UTC()
 	}
+	t, _ := parseFeedTime(raw)
+	return t
+}
 
-	log.Printf("✅ Feed obtenido exitosamente: %s", feed.Title)
+// articleID deriva un identificador estable de un item: el GUID dentro de
+// su feed o, si el feed no lo publica, el enlace y el título.
+func articleID(feedURL, guid, link, title string) string {
+	key := feedURL + "\x00" + strings.TrimSpace(guid)
+	if strings.TrimSpace(guid) == "" {
+		key = feedURL + "\x00" + link + "\x00" + title
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
 
-	var articles []Article
-	for _, item := range feed.Items {
-		date := ""
-		if item.PublishedParsed != nil {
-			date = item.PublishedParsed.Format("2006-01-02 15:04")
-		} else if item.Published != "" {
-			date = item.Published
-		}
+// ==========================
+// Planificador de descarga de feeds en segundo plano
+// ==========================
 
-		description := ""
-		if item.Description != "" {
-			description = item.Description
-		} else if item.Content != "" {
-			description = item.Content
-		}
+// FeedScheduler refresca cada URL de feed distinta (de todos los usuarios)
+// cuando vence su próxima descarga y persiste el resultado en el almacén.
+type FeedScheduler struct {
+	mutex    sync.Mutex
+	inFlight map[string]bool
+	force    bool
+	wake     chan struct{}
+}
 
-		// Mejorar el nombre de la fuente
-		sourceName := feed.Title
-		if sourceName == "" || sourceName == "YouTube" || strings.Contains(sourceName, "uploads by") {
-			// Para YouTube, usar el título del feed si está disponible
-			if strings.Contains(feedURL, "youtube.com") || strings.Contains(feedURL, "youtu.be") {
-				if feed.Title != "" && !strings.Contains(feed.Title, "uploads by") {
-					// Usar el título del feed directamente si es bueno
-					sourceName = feed.Title
-				} else {
-					// Extraer información de la URL como fallback
-					if strings.Contains(feedURL, "/channel/") {
-						channelMatch := regexp.MustCompile(`/channel/([^/\?]+)`).FindStringSubmatch(feedURL)
-						if len(channelMatch) > 1 {
-							channelID := channelMatch[1]
-							if len(channelID) > 12 {
-								channelID = channelID[:12]
-							}
-							sourceName = fmt.Sprintf("YT %s", channelID)
-						} else {
-							sourceName = "YouTube Channel"
-						}
-					} else if strings.Contains(feedURL, "channel_id=") {
-						channelMatch := regexp.MustCompile(`channel_id=([^&]+)`).FindStringSubmatch(feedURL)
-						if len(channelMatch) > 1 {
-							channelID := channelMatch[1]
-							if len(channelID) > 12 {
-								channelID = channelID[:12]
-							}
-							sourceName = fmt.Sprintf("YT %s", channelID)
-						} else {
-							sourceName = "YouTube Channel"
-						}
-					} else if strings.Contains(feedURL, "user=") {
-						userMatch := regexp.MustCompile(`user=([^&]+)`).FindStringSubmatch(feedURL)
-						if len(userMatch) > 1 {
-							sourceName = fmt.Sprintf("YouTube @%s", userMatch[1])
-						} else {
-							sourceName = "YouTube Channel"
-						}
-					} else {
-						sourceName = "YouTube Channel"
-					}
-				}
-			}
-		}
+var feedScheduler = &FeedScheduler{
+	inFlight: make(map[string]bool),
+	wake:     make(chan struct{}, 1),
+}
 
-		// Limpiar y acortar nombres muy largos
-		if len(sourceName) > 30 {
-			sourceName = sourceName[:27] + "..."
-		}
+func (s *FeedScheduler) Run() {
+	ticker := time.NewTicker(SCHEDULER_TICK)
+	defer ticker.Stop()
 
-		article := Article{
-			Title:       item.Title,
-			Link:        item.Link,
-			Date:        date,
-			Source:      sourceName,
-			Description: description,
+	s.refreshDue()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
 		}
-		articles = append(articles, article)
+		s.refreshDue()
 	}
-
-	return articles
 }
 
-func addHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("➕ Add handler called")
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// Wake adelanta la siguiente pasada del planificador
+func (s *FeedScheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
 	}
+}
 
-	feedURL := r.FormValue("url")
-	if feedURL == "" {
-		http.Error(w, "URL required", http.StatusBadRequest)
+// ForceRefresh marca todos los feeds como vencidos en la siguiente pasada
+func (s *FeedScheduler) ForceRefresh() {
+	s.mutex.Lock()
+	s.force = true
+	s.mutex.Unlock()
+	s.Wake()
+}
+
+// RefreshNow descarga un feed inmediatamente (p. ej. al suscribirse)
+func (s *FeedScheduler) RefreshNow(feedURL string) {
+	go s.refresh(feedURL)
+}
+
+func (s *FeedScheduler) refreshDue() {
+	urls, err := store.DistinctFeedURLs()
+	if err != nil {
+		log.Printf("❌ Scheduler: error listing feeds: %v", err)
 		return
 	}
 
-	username := getUserFromRequest(r)
-	feed := Feed{URL: feedURL, Active: true}
-	if err := saveFeedForUser(feed, username); err != nil {
-		log.Printf("❌ Error saving feed: %v", err)
-		http.Error(w, "Error saving feed", http.StatusInternalServerError)
+	s.mutex.Lock()
+	force := s.force
+	s.force = false
+	s.mutex.Unlock()
+
+	now := time.Now()
+	var due []string
+	for _, feedURL := range urls {
+		state, err := store.GetFeedState(feedURL)
+		if force || err != nil || !now.Before(state.NextFetch) {
+			due = append(due, feedURL)
+		}
+	}
+	if len(due) == 0 {
 		return
 	}
+	log.Printf("⏰ Scheduler: refreshing %d of %d feeds", len(due), len(urls))
 
-	log.Printf("✅ Feed added for user %s: %s", username, feedURL)
-	w.Write([]byte("Feed added successfully"))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, SCHEDULER_WORKERS)
+	for _, feedURL := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(feedURL string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.refresh(feedURL)
+		}(feedURL)
+	}
+	wg.Wait()
 }
 
-func favoriteHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("⭐ Favorite handler called")
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (s *FeedScheduler) refresh(feedURL string) {
+	s.mutex.Lock()
+	if s.inFlight[feedURL] {
+		s.mutex.Unlock()
 		return
 	}
+	s.inFlight[feedURL] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.inFlight, feedURL)
+		s.mutex.Unlock()
+	}()
 
-	title := r.FormValue("title")
-	link := r.FormValue("link")
-	date := r.FormValue("date")
-	source := r.FormValue("source")
+	now := time.Now()
+	state := FeedState{URL: feedURL}
+	if previous, err := store.GetFeedState(feedURL); err == nil {
+		state = *previous
+	}
+	state.LastFetch = now
 
-	if title == "" || link == "" {
-		log.Printf("❌ Missing required favorite data")
-		http.Error(w, "Title and link required", http.StatusBadRequest)
+	// Sin metadatos guardados (feeds anteriores a FeedInfo) se pide el feed
+	// completo aunque no haya cambiado
+	etag, lastModified := state.ETag, state.LastModified
+	if state.Info.IsZero() {
+		etag, lastModified = "", ""
+	}
+	result, err := fetchFeedArticles(feedURL, etag, lastModified)
+	state.HTTPStatus = result.StatusCode
+	if err != nil {
+		// Conservar los artículos anteriores y reintentar con backoff exponencial
+		state.ConsecutiveFailures++
+		state.LastError = err.Error()
+		state.NextFetch = backoffFetchTime(now, state.ConsecutiveFailures)
+		log.Printf("⚠️ Scheduler: %s failed %d time(s) in a row, next try at %s", feedURL, state.ConsecutiveFailures, state.NextFetch.Format(time.RFC3339))
+		if err := store.SaveFeedState(state); err != nil {
+			log.Printf("❌ Scheduler: error saving state for %s: %v", feedURL, err)
+		}
 		return
 	}
 
-	favorite := FavoriteArticle{
-		Title:  title,
-		Link:   link,
-		Date:   date,
-		Source: source,
+	state.ConsecutiveFailures = 0
+	state.LastError = ""
+	state.LastSuccess = now
+	state.NextFetch = nextFetchTime(now)
+	state.ETag, state.LastModified = result.ETag, result.LastModified
+	if result.NotModified {
+		if err := store.SaveFeedState(state); err != nil {
+			log.Printf("❌ Scheduler: error saving state for %s: %v", feedURL, err)
+		}
+		return
 	}
 
-	favorites := loadFavoriteArticles()
-
-	// Verificar si ya existe
-	exists := false
-	for _, fav := range favorites {
-		if fav.Link == link {
-			exists = true
-			break
+	// Conservar la fecha de la primera descarga de cada artículo
+	firstSeen := make(map[string]time.Time)
+	for _, a := range loadStoredArticles(feedURL) {
+		firstSeen[a.ID] = a.Fetched
+	}
+	for i := range result.Articles {
+		if t, ok := firstSeen[result.Articles[i].ID]; ok && !t.IsZero() {
+			result.Articles[i].Fetched = t
 		}
 	}
 
-	if !exists {
-		favorites = append(favorites, favorite)
-
-		favoritesJSON, err := json.MarshalIndent(favorites, "", "  ")
-		if err != nil {
-			log.Printf("❌ Error marshaling favorites: %v", err)
-			http.Error(w, "Error saving favorite", http.StatusInternalServerError)
-			return
+	state.Info = result.Info
+	if err := store.SaveFetchResult(state, result.Articles); err != nil {
+		log.Printf("❌ Scheduler: error saving articles for %s: %v", feedURL, err)
+		return
+	}
+	// Sólo los nuevos: los ya indexados pueden tener el contenido extraído
+	var fresh []Article
+	for _, a := range result.Articles {
+		if _, seen := firstSeen[a.ID]; !seen {
+			fresh = append(fresh, a)
 		}
+	}
+	indexArticles(fresh)
+	applyFilterRules(feedURL, fresh)
+	if _, err := store.UpdateFeedInfo(feedURL, result.Info); err != nil {
+		log.Printf("❌ Scheduler: error updating feed info for %s: %v", feedURL, err)
+	}
+	log.Printf("💾 Scheduler: stored %d articles from %s", len(result.Articles), feedURL)
+}
 
-		if err := os.WriteFile("favorites.json", favoritesJSON, 0644); err != nil {
-			log.Printf("❌ Error saving favorites file: %v", err)
-			http.Error(w, "Error saving favorite", http.StatusInternalServerError)
-			return
-		}
+// Próxima descarga: FEED_REFRESH_INTERVAL ±10% para repartir la carga
+func nextFetchTime(now time.Time) time.Time {
+	return now.Add(withJitter(FEED_REFRESH_INTERVAL))
+}
 
-		log.Printf("✅ Favorite added: %s", title)
+// Tras un fallo se duplica la espera en cada fallo consecutivo, hasta
+// FEED_MAX_BACKOFF
+func backoffFetchTime(now time.Time, failures int) time.Time {
+	delay := FEED_REFRESH_INTERVAL
+	for i := 1; i < failures && delay < FEED_MAX_BACKOFF; i++ {
+		delay *= 2
+	}
+	if delay > FEED_MAX_BACKOFF {
+		delay = FEED_MAX_BACKOFF
+	}
+	return now.Add(withJitter(delay))
+}
+
+func withJitter(d time.Duration) time.Duration {
+	return d - d/10 + time.Duration(mrand.Int64N(int64(d/5)))
+}
+
+// Cliente HTTP compartido por todas las descargas de feeds
+var feedHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Resultado de una descarga condicional de un feed
+type feedFetchResult struct {
+	Articles     []Article
+	Info         FeedInfo
+	NotModified  bool
+	ETag         string
+	LastModified string
+	StatusCode   int
+}
+
+// feedSourceName es el nombre de la fuente que se guarda con cada artículo:
+// el que da el adaptador del servicio o, si no hay, el título del feed.
+func feedSourceName(feedURL string, feed *gofeed.Feed, adapter sources.Adapter) string {
+	sourceName := strings.TrimSpace(feed.Title)
+	if adapter != nil {
+		if name := adapter.SourceName(feedURL, feed); name != "" {
+			sourceName = name
+		}
+	}
+	if sourceName == "" {
+		if u, err := url.Parse(feedURL); err == nil {
+			sourceName = u.Hostname()
+		}
+	}
+	return shortSourceName(sourceName)
+}
+
+// feedInfo extrae los metadatos del feed. El favicon se toma de la raíz del
+// sitio, que es donde lo publican casi todos.
+func feedInfo(feed *gofeed.Feed) FeedInfo {
+	info := FeedInfo{
+		Title:       strings.TrimSpace(feed.Title),
+		SiteURL:     strings.TrimSpace(feed.Link),
+		Description: strings.TrimSpace(feed.Description),
+	}
+	if u, err := url.Parse(info.SiteURL); err == nil && u.Scheme != "" && u.Host != "" {
+		info.FaviconURL = u.Scheme + "://" + u.Host + "/favicon.ico"
+	}
+	return info
+}
+
+// fetchFeedArticles descarga el feed enviando If-None-Match/If-Modified-Since
+// con los validadores de la descarga anterior. Un 304 se devuelve como
+// NotModified sin artículos. El resultado nunca es nil, para poder leer
+// StatusCode también cuando hay error.
+func fetchFeedArticles(feedURL, etag, lastModified string) (*feedFetchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result := &feedFetchResult{}
+
+	log.Printf("🌐 Intentando acceder al feed: %s", feedURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		log.Printf("❌ Error al acceder al feed %s: %v", feedURL, err)
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+
+	if resp.StatusCode == http.StatusNotModified {
+		log.Printf("🟰 Feed sin cambios (304): %s", feedURL)
+		result.NotModified = true
+		// Algunos servidores no repiten los validadores en el 304
+		if result.ETag == "" {
+			result.ETag = etag
+		}
+		if result.LastModified == "" {
+			result.LastModified = lastModified
+		}
+		return result, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+		log.Printf("❌ Error al acceder al feed %s: %v", feedURL, err)
+		return result, err
+	}
+
+	feed, err := gofeed.NewParser().Parse(resp.Body)
+	if err != nil {
+		log.Printf("❌ Error al parsear el feed %s: %v", feedURL, err)
+		return result, err
+	}
+
+	log.Printf("✅ Feed obtenido exitosamente: %s", feed.Title)
+
+	adapter := sources.ForFeed(feedURL)
+	sourceName := feedSourceName(feedURL, feed, adapter)
+	result.Info = feedInfo(feed)
+	if adapter != nil || result.Info.Title == "" {
+		result.Info.Title = sourceName
+	}
+
+	fetched := time.Now().UTC()
+	var articles []Article
+	for _, item := range feed.Items {
+		published := feedItemTime(item.PublishedParsed, item.Published)
+		updated := feedItemTime(item.UpdatedParsed, item.Updated)
+		date := item.Published
+		if date == "" {
+			date = item.Updated
+		}
+
+		description := ""
+		if item.Description != "" {
+			description = item.Description
+		} else if item.Content != "" {
+			description = item.Content
+		}
+
+		article := Article{
+			ID:          articleID(feedURL, item.GUID, item.Link, item.Title),
+			FeedURL:     feedURL,
+			Title:       item.Title,
+			Link:        item.Link,
+			Date:        date,
+			Published:   published,
+			Updated:     updated,
+			Fetched:     fetched,
+			Source:      sourceName,
+			Author:      itemAuthor(item),
+			Description: description,
+		}
+		sources.Enrich(adapter, item, &article)
+		articles = append(articles, article)
+	}
+
+	result.Articles = articles
+	return result, nil
+}
+
+// itemAuthor devuelve los autores de un artículo separados por comas
+func itemAuthor(item *gofeed.Item) string {
+	var names []string
+	for _, author := range item.Authors {
+		if author != nil && strings.TrimSpace(author.Name) != "" {
+			names = append(names, strings.TrimSpace(author.Name))
+		}
+	}
+	if len(names) == 0 && item.Author != nil {
+		return strings.TrimSpace(item.Author.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// addHandler suscribe al usuario a un feed. Acepta la URL del feed o la de
+// una web: en ese caso se buscan sus feeds (autodescubrimiento). Si se
+// encuentra más de uno se devuelven para que el usuario elija y vuelva a
+// llamar con la URL elegida. Opcionalmente recibe name y category.
+func addHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("➕ Add handler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	input := strings.TrimSpace(r.FormValue("url"))
+	if input == "" {
+		http.Error(w, "URL required", http.StatusBadRequest)
+		return
+	}
+
+	// Entradas de servicios conocidos (@canal de YouTube, r/subreddit,
+	// cuenta de Mastodon, repo de GitHub) se traducen a la URL de su feed
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	resolved, adapter, matched, err := sources.Resolve(ctx, feedHTTPClient, input)
+	if matched && err != nil {
+		log.Printf("⚠️ %s adapter could not resolve %s: %v", adapter.Name(), input, err)
+		http.Error(w, "Could not resolve "+input, http.StatusUnprocessableEntity)
+		return
+	}
+	if matched {
+		log.Printf("🔌 %s adapter resolved %s to %s", adapter.Name(), input, resolved)
+	}
+
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	if !matched {
+		resolved = input
+	}
+	if _, err := normalizeFeedURL(resolved); err != nil {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := discoverFeeds(resolved)
+	// Si el adaptador se equivocó (p. ej. una web con URLs /@usuario que no
+	// es Mastodon) se busca en la URL original, si lo era
+	if err != nil && matched && resolved != input {
+		if _, urlErr := normalizeFeedURL(input); urlErr == nil {
+			if fallback, fallbackErr := discoverFeeds(input); fallbackErr == nil {
+				candidates, err = fallback, nil
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ No feeds found at %s: %v", resolved, err)
+		http.Error(w, "No feed found at "+resolved, http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(candidates) > 1 {
+		log.Printf("🔎 %d feeds discovered at %s", len(candidates), input)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "choose", "feeds": candidates})
+		return
+	}
+
+	username := getUserFromRequest(r)
+	candidate := candidates[0]
+	normalized, _ := normalizeFeedURL(candidate.URL)
+	for _, existing := range loadFeedsForUser(username) {
+		if existingNormalized, err := normalizeFeedURL(existing.URL); err == nil && existingNormalized == normalized {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "exists", "feed": existing})
+			return
+		}
+	}
+
+	feed := Feed{
+		URL:        candidate.URL,
+		Active:     true,
+		CustomName: strings.TrimSpace(r.FormValue("name")),
+		Category:   strings.TrimSpace(r.FormValue("category")),
+	}
+	feed.SetInfo(candidate.Info)
+	if err := saveFeedForUser(feed, username); err != nil {
+		log.Printf("❌ Error saving feed: %v", err)
+		http.Error(w, "Error saving feed", http.StatusInternalServerError)
+		return
+	}
+
+	feedScheduler.RefreshNow(feed.URL)
+	log.Printf("✅ Feed added for user %s: %s", username, feed.URL)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "subscribed", "feed": feed})
+}
+
+// ==========================
+// Autodescubrimiento de feeds
+// ==========================
+
+// Rutas donde suelen publicarse los feeds cuando la web no los anuncia
+var commonFeedPaths = []string{
+	"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml",
+	"/feed.json", "/feeds/posts/default", "/?feed=rss2",
+}
+
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+type discoveredFeed struct {
+	URL  string   `json:"url"`
+	Info FeedInfo `json:"info"`
+}
+
+// normalizeFeedURL deja la URL en una forma canónica para detectar
+// duplicados: esquema y host en minúsculas, sin puerto por defecto, sin
+// fragmento y sin "/" final en la ruta.
+func normalizeFeedURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("not an http(s) URL: %q", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+	if u.Path == "/" {
+		u.Path = ""
+	}
+	return u.String(), nil
+}
+
+// discoverFeeds devuelve los feeds válidos que corresponden a pageURL: la
+// propia URL si ya es un feed o, si es una web, los que anuncia con
+// <link rel="alternate"> y los que haya en las rutas habituales. Cada
+// candidato se valida con fetchFeed.
+func discoverFeeds(pageURL string) ([]discoveredFeed, error) {
+	if feed, err := fetchFeed(pageURL); err == nil {
+		return []discoveredFeed{{URL: pageURL, Info: feedInfo(feed)}}, nil
+	}
+
+	candidates, err := feedLinksFromPage(pageURL)
+	if err != nil {
+		log.Printf("⚠️ Could not read %s for autodiscovery: %v", pageURL, err)
+	}
+	// Las rutas habituales sólo si la página no anuncia ningún feed
+	if len(candidates) == 0 {
+		base, _ := url.Parse(pageURL)
+		for _, path := range commonFeedPaths {
+			if ref, err := url.Parse(path); err == nil {
+				candidates = append(candidates, base.ResolveReference(ref).String())
+			}
+		}
+	}
+
+	// Validar en paralelo conservando el orden de los candidatos
+	found := make([]*discoveredFeed, len(candidates))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 4)
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, candidate string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if feed, err := fetchFeed(candidate); err == nil {
+				found[i] = &discoveredFeed{URL: candidate, Info: feedInfo(feed)}
+			}
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	// Se guarda la URL exacta que se validó; la normalizada sólo sirve para
+	// no repetir el mismo feed escrito de dos formas
+	seen := make(map[string]bool)
+	var feeds []discoveredFeed
+	for _, f := range found {
+		if f == nil {
+			continue
+		}
+		normalized, err := normalizeFeedURL(f.URL)
+		if err != nil || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		feeds = append(feeds, *f)
+	}
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no feeds found at %s", pageURL)
+	}
+	return feeds, nil
+}
+
+// feedLinksFromPage descarga la página y devuelve las URLs absolutas de sus
+// <link rel="alternate"> de tipo RSS, Atom o JSON Feed.
+func feedLinksFromPage(pageURL string) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body, err := utf8HTMLBody(resp, 2<<20)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, err
+	}
+	// La URL final (tras redirecciones) y <base href> resuelven las relativas
+	base := resp.Request.URL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(href); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+
+	var links []string
+	doc.Find("link[href]").Each(func(_ int, sel *goquery.Selection) {
+		rel := strings.ToLower(sel.AttrOr("rel", ""))
+		kind := strings.ToLower(strings.TrimSpace(sel.AttrOr("type", "")))
+		if !strings.Contains(" "+rel+" ", " alternate ") || !feedLinkTypes[kind] {
+			return
+		}
+		ref, err := url.Parse(strings.TrimSpace(sel.AttrOr("href", "")))
+		if err != nil {
+			return
+		}
+		links = append(links, base.ResolveReference(ref).String())
+	})
+	return links, nil
+}
+
+func favoriteHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("⭐ Favorite handler called")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	title := r.FormValue("title")
+	link := r.FormValue("link")
+	date := r.FormValue("date")
+	source := r.FormValue("source")
+
+	if title == "" || link == "" {
+		log.Printf("❌ Missing required favorite data")
+		http.Error(w, "Title and link required", http.StatusBadRequest)
+		return
+	}
+
+	favorite := FavoriteArticle{
+		Title:  title,
+		Link:   link,
+		Date:   date,
+		Source: source,
+	}
+
+	added, err := store.AddFavorite(favorite)
+	if err != nil {
+		log.Printf("❌ Error saving favorite: %v", err)
+		http.Error(w, "Error saving favorite", http.StatusInternalServerError)
+		return
+	}
+
+	if added {
+		log.Printf("✅ Favorite added: %s", title)
 		w.Write([]byte("Added"))
 	} else {
 		log.Printf("ℹ️ Favorite already exists: %s", title)
@@ -2387,92 +4211,1127 @@ func apiFavoritesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("✅ Returned %d favorites", len(favorites))
+	log.Printf("✅ Returned %d favorites", len(favorites))
+}
+
+// ==========================
+// Estado leído/no leído/destacado por usuario
+// ==========================
+func loadArticleStates(username string, articles []Article) map[string]storage.ArticleState {
+	ids := make([]string, 0, len(articles))
+	for _, a := range articles {
+		ids = append(ids, a.ID)
+	}
+	states, err := store.ArticleStates(username, ids)
+	if err != nil {
+		log.Printf("❌ Error loading article states for %s: %v", username, err)
+	}
+	return states
+}
+
+// articleStateHandler marca artículos como leídos (read=true) o no leídos.
+// Recibe {"ids": [...]}.
+func articleStateHandler(read bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+			http.Error(w, "ids required", http.StatusBadRequest)
+			return
+		}
+		username := getUserFromRequest(r)
+		if err := store.SetRead(username, req.IDs, read); err != nil {
+			log.Printf("❌ Error updating read state for %s: %v", username, err)
+			http.Error(w, "Error saving state", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "count": len(req.IDs)})
+	}
+}
+
+// markAllReadHandler marca como leídos todos los artículos guardados de los
+// feeds activos del usuario, o sólo los de {"feed": url} o los del smart
+// feed {"smart": id} si se indica.
+func markAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Feed  string `json:"feed"`
+		Smart string `json:"smart"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	username := getUserFromRequest(r)
+
+	var ids []string
+	if req.Smart != "" {
+		// Sólo lo que se ve en el smart feed
+		for _, a := range riverArticles(username, riverFilter{Smart: req.Smart}) {
+			ids = append(ids, a.ID)
+		}
+	} else {
+		found := false
+		for _, feed := range loadFeedsForUser(username) {
+			if req.Feed != "" && feed.URL != req.Feed {
+				continue
+			}
+			if req.Feed == "" && !feed.Active {
+				continue
+			}
+			found = true
+			for _, a := range loadStoredArticles(feed.URL) {
+				ids = append(ids, a.ID)
+			}
+		}
+		if req.Feed != "" && !found {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+	}
+	if err := store.SetRead(username, ids, true); err != nil {
+		log.Printf("❌ Error marking all read for %s: %v", username, err)
+		http.Error(w, "Error saving state", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ %d articles marked read for %s", len(ids), username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "count": len(ids)})
+}
+
+// starArticleHandler destaca o quita el destacado de un artículo.
+// Recibe {"id": "...", "starred": true}.
+func starArticleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID      string `json:"id"`
+		Starred bool   `json:"starred"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+	username := getUserFromRequest(r)
+	if err := store.SetStarred(username, req.ID, req.Starred); err != nil {
+		log.Printf("❌ Error updating star for %s: %v", username, err)
+		http.Error(w, "Error saving state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "starred": req.Starred})
+}
+
+// articlePositionHandler guarda por dónde va el usuario en el episodio
+// (audio o vídeo) de un artículo. Recibe {"id": "...", "position": segundos};
+// position 0 lo da por terminado.
+func articlePositionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID       string `json:"id"`
+		Position int    `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" || req.Position < 0 {
+		http.Error(w, "id and position required", http.StatusBadRequest)
+		return
+	}
+	username := getUserFromRequest(r)
+	if err := store.SetPosition(username, req.ID, req.Position); err != nil {
+		log.Printf("❌ Error saving playback position for %s: %v", username, err)
+		http.Error(w, "Error saving state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "position": req.Position})
+}
+
+func saveListHandler(listName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username := getUserFromRequest(r)
+		var req struct{ Title, Link, Source string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Link == "" {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		item := storage.ListItem{Title: req.Title, Link: req.Link, Source: req.Source, User: username}
+		if err := store.AppendListItem(username, listName, item); err != nil {
+			log.Printf("❌ Error saving %s item for %s: %v", listName, username, err)
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+		indexListItem(username, item, time.Now().UTC())
+		// Copia offline por si la página desaparece
+		go archiveArticle(item.Link, item.Title)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}
+}
+
+func listHandler(listName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := getUserFromRequest(r)
+		items, err := store.ListItems(username, listName)
+		if err != nil {
+			log.Printf("❌ Error loading %s list for %s: %v", listName, username, err)
+			http.Error(w, "Failed to load list", http.StatusInternalServerError)
+			return
+		}
+
+		// Indicar qué artículos tienen copia offline. Los que no la tienen
+		// los archiva archivePending, no cada visita a la lista.
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = contentCacheKey(item.Link)
+		}
+		archived, err := store.SnapshotTimes(keys)
+		if err != nil {
+			log.Printf("❌ Error loading snapshots for %s: %v", username, err)
+		}
+		type listEntry struct {
+			storage.ListItem
+			ArchivedAt *time.Time `json:"archived_at,omitempty"`
+		}
+		entries := make([]listEntry, len(items))
+		for i, item := range items {
+			entries[i].ListItem = item
+			if t, ok := archived[keys[i]]; ok {
+				entries[i].ArchivedAt = &t
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// ==========================
+// Copias offline de SAVED/LOVED
+// ==========================
+
+// Archivados en curso (por URL normalizada) y cupo de archivados a la vez.
+// Las imágenes de cada archivado se descargan de una en una.
+var archiving sync.Map
+var archiveSlots = make(chan struct{}, 2)
+
+// archiveArticle guarda una copia offline de link, con el contenido
+// extraído y sus imágenes, si todavía no la tiene. Los fallos se anotan y
+// no se reintenta hasta que pasa contentRetryDelay; tras
+// SNAPSHOT_MAX_ATTEMPTS fallos se abandona.
+func archiveArticle(link, title string) {
+	key := contentCacheKey(link)
+	if _, busy := archiving.LoadOrStore(key, true); busy {
+		return
+	}
+	defer archiving.Delete(key)
+	if _, err := store.GetSnapshot(key); err == nil {
+		return
+	}
+	previous, err := store.GetSnapshotAttempt(key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("❌ Error loading snapshot attempts of %s: %v", link, err)
+		return
+	}
+	if previous != nil && (previous.Failures >= SNAPSHOT_MAX_ATTEMPTS || time.Since(previous.LastAttempt) < contentRetryDelay(previous.Failures)) {
+		return
+	}
+
+	archiveSlots <- struct{}{}
+	defer func() { <-archiveSlots }()
+
+	content, _, err := articleContent(link)
+	if err != nil {
+		attempt := storage.SnapshotAttempt{URL: key, Failures: 1, Error: err.Error(), LastAttempt: time.Now().UTC()}
+		if previous != nil {
+			attempt.Failures = previous.Failures + 1
+		}
+		log.Printf("⚠️ Could not archive %s (attempt %d): %v", link, attempt.Failures, err)
+		if err := store.SaveSnapshotAttempt(attempt); err != nil {
+			log.Printf("❌ Error saving snapshot attempt of %s: %v", link, err)
+		}
+		return
+	}
+	// La fecha de la copia es la de la descarga, que puede venir de la caché
+	fetchedAt := time.Now().UTC()
+	if entry, err := store.GetContent(key); err == nil && entry.Error == "" {
+		fetchedAt = entry.FetchedAt
+	}
+
+	content, images := localizeImages(content)
+	snapshot := storage.Snapshot{URL: key, OriginalURL: link, Title: title, Content: content, FetchedAt: fetchedAt}
+	for id := range images {
+		snapshot.Images = append(snapshot.Images, id)
+	}
+	sort.Strings(snapshot.Images)
+	if err := store.SaveSnapshot(snapshot, images); err != nil {
+		log.Printf("❌ Error saving snapshot of %s: %v", link, err)
+		return
+	}
+	log.Printf("📦 Archived %s (%d images)", link, len(images))
+	setSearchContent(link, content)
+}
+
+// archivePending archiva, de uno en uno, los artículos de SAVED/LOVED que
+// todavía no tienen copia: los guardados antes de existir las copias y los
+// que fallaron y ya pueden reintentarse.
+func archivePending() {
+	users, err := store.ListUsers()
+	if err != nil {
+		log.Printf("❌ Error listing users for archiving: %v", err)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, user := range users {
+		for _, list := range []string{"saved", "loved"} {
+			items, err := store.ListItems(user.Username, list)
+			if err != nil {
+				continue
+			}
+			for _, item := range items {
+				if key := contentCacheKey(item.Link); !seen[key] {
+					seen[key] = true
+					archiveArticle(item.Link, item.Title)
+				}
+			}
+		}
+	}
+}
+
+// snapshotHTTPClient descarga las imágenes de las copias offline. Sus URLs
+// salen de HTML de terceros, así que sólo se conecta a direcciones públicas
+// (nada de loopback, redes privadas ni 169.254.169.254) y sin proxy, para
+// que la comprobación se haga sobre la IP real.
+var snapshotHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   publicAddressOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// publicAddressOnly es el Control del dialer: rechaza la conexión si la IP
+// ya resuelta (también tras una redirección) no es pública.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || (ip4[0] == 100 && ip4[1]&0xc0 == 64)) {
+		// 0.0.0.0/8 y 100.64.0.0/10 (NAT del operador)
+		return false
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// localizeImages descarga las imágenes del contenido y apunta su src a la
+// copia local (/archive/image/<id>). Las que no se pueden descargar
+// conservan la URL original.
+func localizeImages(content string) (string, map[string]storage.SnapshotImage) {
+	images := make(map[string]storage.SnapshotImage)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<body>" + content + "</body>"))
+	if err != nil {
+		return content, images
+	}
+	local := make(map[string]string) // URL original -> id
+	doc.Find("img[src]").Each(func(_ int, img *goquery.Selection) {
+		src := img.AttrOr("src", "")
+		id, ok := local[src]
+		if !ok {
+			if len(local) >= SNAPSHOT_MAX_IMAGES {
+				return
+			}
+			image, err := downloadImage(src)
+			if err != nil {
+				log.Printf("⚠️ Could not archive image %s: %v", src, err)
+				return
+			}
+			sum := sha256.Sum256(image.Data)
+			id = hex.EncodeToString(sum[:16])
+			images[id] = image
+			local[src] = id
+		}
+		img.SetAttr("src", "/archive/image/"+id)
+	})
+	archived, err := doc.Find("body").Html()
+	if err != nil {
+		return content, map[string]storage.SnapshotImage{}
+	}
+	return archived, images
+}
+
+func downloadImage(src string) (storage.SnapshotImage, error) {
+	if u, err := url.Parse(src); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return storage.SnapshotImage{}, fmt.Errorf("not an http(s) URL: %q", src)
+	}
+	resp, err := snapshotHTTPClient.Get(src)
+	if err != nil {
+		return storage.SnapshotImage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return storage.SnapshotImage{}, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return storage.SnapshotImage{}, fmt.Errorf("not an image: %q", mimeType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, SNAPSHOT_MAX_IMAGE_BYTES+1))
+	if err != nil {
+		return storage.SnapshotImage{}, err
+	}
+	if len(data) > SNAPSHOT_MAX_IMAGE_BYTES {
+		return storage.SnapshotImage{}, fmt.Errorf("image larger than %d bytes", SNAPSHOT_MAX_IMAGE_BYTES)
+	}
+	return storage.SnapshotImage{Type: mimeType, Data: data}, nil
+}
+
+// inUserLists indica si link está en SAVED o LOVED del usuario
+func inUserLists(username, link string) bool {
+	key := contentCacheKey(link)
+	for _, list := range []string{"saved", "loved"} {
+		items, _ := store.ListItems(username, list)
+		for _, item := range items {
+			if contentCacheKey(item.Link) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// archiveHandler devuelve la copia offline de ?url=, que tiene que estar en
+// las listas del usuario.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	link := r.URL.Query().Get("url")
+	username := getUserFromRequest(r)
+	if link == "" || !inUserLists(username, link) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	snapshot, err := store.GetSnapshot(contentCacheKey(link))
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("❌ Error loading snapshot of %s: %v", link, err)
+		}
+		http.Error(w, "Not archived", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        snapshot.OriginalURL,
+		"title":      snapshot.Title,
+		"content":    snapshot.Content,
+		"fetched_at": snapshot.FetchedAt,
+	})
+}
+
+// archiveImageHandler sirve las imágenes de las copias offline. Se sirven
+// desde nuestro origen, así que un SVG no debe poder ejecutar scripts.
+func archiveImageHandler(w http.ResponseWriter, r *http.Request) {
+	image, err := store.GetSnapshotImage(strings.TrimPrefix(r.URL.Path, "/archive/image/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", image.Type)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Write(image.Data)
+}
+
+// ==========================
+// Búsqueda de texto completo
+// ==========================
+
+// articleDocument es lo que se indexa de un artículo de un feed
+func articleDocument(a Article) search.Document {
+	return search.Document{
+		Type:      search.TypeArticle,
+		FeedURL:   a.FeedURL,
+		Link:      a.Link,
+		Title:     a.Title,
+		Source:    a.Source,
+		Summary:   search.PlainText(a.Description),
+		Published: a.Published,
+	}
+}
+
+func indexArticles(articles []Article) {
+	docs := make(map[string]search.Document, len(articles))
+	for _, a := range articles {
+		docs["article:"+a.ID] = articleDocument(a)
+	}
+	if err := searchIndex.Index(docs); err != nil {
+		log.Printf("❌ Error indexing %d articles: %v", len(docs), err)
+	}
+}
+
+// indexListItem indexa un artículo de SAVED/LOVED de username, visible sólo
+// para él aunque deje de estar en sus feeds. Si ya tiene copia offline se
+// indexa también su contenido.
+func indexListItem(username string, item storage.ListItem, saved time.Time) {
+	key := contentCacheKey(item.Link)
+	doc := search.Document{
+		Type:      search.TypeSaved,
+		Owner:     username,
+		Link:      item.Link,
+		Title:     item.Title,
+		Source:    item.Source,
+		Published: saved,
+	}
+	if snapshot, err := store.GetSnapshot(key); err == nil {
+		doc.Content = search.PlainText(snapshot.Content)
+		if saved.IsZero() {
+			doc.Published = snapshot.FetchedAt
+		}
+	}
+	err := searchIndex.Index(map[string]search.Document{"saved:" + username + ":" + key: doc})
+	if err != nil {
+		log.Printf("❌ Error indexing saved %s for %s: %v", item.Link, username, err)
+	}
+}
+
+// setSearchContent añade el contenido extraído de link a sus documentos
+func setSearchContent(link, content string) {
+	if _, err := searchIndex.SetContent(link, search.PlainText(content)); err != nil {
+		log.Printf("❌ Error indexing content of %s: %v", link, err)
+	}
+}
+
+// reindexAll llena un índice vacío con los artículos guardados en la base
+// de datos y las listas SAVED/LOVED de todos los usuarios
+func reindexAll() {
+	start := time.Now()
+	urls, err := store.DistinctFeedURLs()
+	if err != nil {
+		log.Printf("❌ Error listing feeds for indexing: %v", err)
+		return
+	}
+	articles := 0
+	for _, url := range urls {
+		stored := loadStoredArticles(url)
+		indexArticles(stored)
+		articles += len(stored)
+	}
+
+	users, err := store.ListUsers()
+	if err != nil {
+		log.Printf("❌ Error listing users for indexing: %v", err)
+		return
+	}
+	saved := 0
+	for _, user := range users {
+		for _, list := range []string{"saved", "loved"} {
+			items, err := store.ListItems(user.Username, list)
+			if err != nil {
+				continue
+			}
+			for _, item := range items {
+				indexListItem(user.Username, item, time.Time{})
+			}
+			saved += len(items)
+		}
+	}
+	log.Printf("🔎 Search index built: %d articles and %d saved items in %v", articles, saved, time.Since(start).Round(time.Millisecond))
+}
+
+// searchFeedNames da a source: el nombre con el que el usuario ve cada feed
+// (su nombre personalizado o el título). Los feeds sin ninguno de los dos se
+// siguen buscando por la fuente indexada.
+func searchFeedNames(feeds []Feed) map[string]string {
+	names := make(map[string]string, len(feeds))
+	for _, feed := range feeds {
+		if feed.CustomName != "" || feed.Title != "" {
+			names[feed.URL] = feed.DisplayName()
+		}
+	}
+	return names
+}
+
+// searchHandler: GET /api/search?q=...&limit=20&offset=0. q admite
+// palabras, "frases", -exclusiones, source:, after: y before: (AAAA-MM-DD en
+// la zona horaria del usuario). Busca en los artículos de sus feeds y en sus
+// guardados, por relevancia.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	username := getUserFromRequest(r)
+	_, location := userLocation(username)
+	q, err := search.ParseQuery(r.URL.Query().Get("q"), location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.IsEmpty() {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+	limit, offset := SEARCH_PAGE_SIZE, 0
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, SEARCH_MAX_PAGE_SIZE)
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && n > 0 {
+		offset = n
+	}
+
+	feeds := loadFeedsForUser(username)
+	scope := search.Scope{Owner: username, FeedNames: searchFeedNames(feeds)}
+	for _, feed := range feeds {
+		scope.FeedURLs = append(scope.FeedURLs, feed.URL)
+	}
+	results, err := searchIndex.Search(q, scope, limit, offset)
+	if err != nil {
+		log.Printf("❌ Search %q failed for %s: %v", r.URL.Query().Get("q"), username, err)
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Un artículo guardado que sigue en los feeds sale una sola vez
+	seen := make(map[string]bool)
+	hits := make([]search.Hit, 0, len(results.Hits))
+	sourceNames := make(map[string]string, len(feeds))
+	for _, feed := range feeds {
+		sourceNames[feed.URL] = riverSourceName(feed)
+	}
+	for _, hit := range results.Hits {
+		if key := contentCacheKey(hit.Link); !seen[key] {
+			seen[key] = true
+			// La fuente como se ve en el río, no la indexada al descargarlo
+			if name := sourceNames[hit.FeedURL]; name != "" {
+				hit.Source = name
+			}
+			hits = append(hits, hit)
+		}
+	}
+	response := map[string]any{
+		"query":   r.URL.Query().Get("q"),
+		"total":   results.Total,
+		"results": hits,
+	}
+	if next := offset + len(results.Hits); uint64(next) < results.Total {
+		response["next_offset"] = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ==========================
+// Smart feeds (búsquedas guardadas)
+// ==========================
+
+// smartFeedCount es una búsqueda guardada con sus artículos sin leer
+type smartFeedCount struct {
+	storage.SmartFeed
+	Unread int    `json:"unread"`
+	RSSURL string `json:"rss_url"`
+}
+
+func findSmartFeed(username, id string) *storage.SmartFeed {
+	feeds, err := store.ListSmartFeeds(username)
+	if err != nil {
+		log.Printf("❌ Error loading smart feeds for %s: %v", username, err)
+		return nil
+	}
+	for i := range feeds {
+		if feeds[i].ID == id {
+			return &feeds[i]
+		}
+	}
+	return nil
+}
+
+// smartFeedArticles deja, en su orden, los artículos que cumplen la búsqueda
+// guardada id. Se busca en el índice sólo entre esos artículos.
+func smartFeedArticles(username, id string, articles []Article) []Article {
+	smart := findSmartFeed(username, id)
+	if smart == nil || len(articles) == 0 {
+		return nil
+	}
+	return matchSmartFeed(username, *smart, articles)
+}
+
+func matchSmartFeed(username string, smart storage.SmartFeed, articles []Article) []Article {
+	_, location := userLocation(username)
+	q, err := search.ParseQuery(smart.Query, location)
+	if err != nil || q.IsEmpty() || len(articles) == 0 {
+		return nil
+	}
+	// source: busca por el nombre que el usuario da a cada feed, el mismo
+	// que ve en el río y en el RSS
+	scope := search.Scope{FeedNames: searchFeedNames(loadFeedsForUser(username))}
+	seenFeeds := make(map[string]bool)
+	for _, a := range articles {
+		scope.IDs = append(scope.IDs, "article:"+a.ID)
+		if !seenFeeds[a.FeedURL] {
+			seenFeeds[a.FeedURL] = true
+			scope.FeedURLs = append(scope.FeedURLs, a.FeedURL)
+		}
+	}
+	results, err := searchIndex.Search(q, scope, len(scope.IDs), 0)
+	if err != nil {
+		log.Printf("❌ Smart feed %q failed for %s: %v", smart.Name, username, err)
+		return nil
+	}
+	matches := make(map[string]bool, len(results.Hits))
+	for _, hit := range results.Hits {
+		matches[strings.TrimPrefix(hit.ID, "article:")] = true
+	}
+	matched := make([]Article, 0, len(matches))
+	for _, a := range articles {
+		if matches[a.ID] {
+			matched = append(matched, a)
+		}
+	}
+	return matched
+}
+
+// smartFeedList devuelve las búsquedas guardadas del usuario sin contar sus
+// no leídos, que la página pide después a /api/smart-feeds
+func smartFeedList(username string) []smartFeedCount {
+	feeds, err := store.ListSmartFeeds(username)
+	if err != nil {
+		log.Printf("❌ Error loading smart feeds for %s: %v", username, err)
+		return nil
+	}
+	list := make([]smartFeedCount, 0, len(feeds))
+	for _, smart := range feeds {
+		list = append(list, smartFeedCount{SmartFeed: smart, RSSURL: "/smart/" + smart.Token + ".xml"})
+	}
+	return list
+}
+
+// smartFeedCounts devuelve las búsquedas guardadas del usuario con cuántos
+// artículos sin leer del río cumplen cada una
+func smartFeedCounts(username string) []smartFeedCount {
+	counts := smartFeedList(username)
+	if len(counts) == 0 {
+		return counts
+	}
+	unread := riverArticles(username, riverFilter{})
+	for i := range counts {
+		counts[i].Unread = len(matchSmartFeed(username, counts[i].SmartFeed, unread))
+	}
+	return counts
+}
+
+// smartFeedsHandler gestiona las búsquedas guardadas del usuario:
+// GET las lista con sus no leídos, POST {"name", "query"} crea una (o la
+// renombra/cambia si lleva "id") y DELETE ?id= la borra.
+func smartFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	username := getUserFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		counts := smartFeedCounts(username)
+		if counts == nil {
+			counts = []smartFeedCount{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(counts)
+
+	case http.MethodPost:
+		var req struct{ ID, Name, Query string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Name, req.Query = strings.TrimSpace(req.Name), strings.TrimSpace(req.Query)
+		_, location := userLocation(username)
+		q, err := search.ParseQuery(req.Query, location)
+		if err == nil && q.IsEmpty() {
+			err = errors.New("empty query")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			req.Name = req.Query
+		}
+
+		var smart storage.SmartFeed
+		if req.ID != "" {
+			existing := findSmartFeed(username, req.ID)
+			if existing == nil {
+				http.Error(w, "Smart feed not found", http.StatusNotFound)
+				return
+			}
+			smart = *existing
+		} else {
+			// El ID va en la URL del río; el token, secreto, en la del RSS
+			id := make([]byte, 8)
+			if _, err := rand.Read(id); err != nil {
+				http.Error(w, "Failed to create smart feed", http.StatusInternalServerError)
+				return
+			}
+			token, err := generateSessionID()
+			if err != nil {
+				http.Error(w, "Failed to create smart feed", http.StatusInternalServerError)
+				return
+			}
+			smart = storage.SmartFeed{ID: hex.EncodeToString(id), Token: token, Created: time.Now().UTC()}
+		}
+		smart.Name, smart.Query = req.Name, req.Query
+		if err := store.SaveSmartFeed(username, smart); err != nil {
+			log.Printf("❌ Error saving smart feed for %s: %v", username, err)
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("🧠 Smart feed %q (%s) saved for %s", smart.Name, smart.Query, username)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(smart)
+
+	case http.MethodDelete:
+		found, err := store.DeleteSmartFeed(username, r.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("❌ Error deleting smart feed for %s: %v", username, err)
+			http.Error(w, "Failed to delete", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Smart feed not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
 }
 
-// Persistencia simple por usuario
-func appendJSONItem(path string, item any) error {
-	var arr []any
-	if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
-		_ = json.Unmarshal(b, &arr)
-	}
-	arr = append(arr, item)
-	b, _ := json.MarshalIndent(arr, "", "  ")
-	return os.WriteFile(path, b, 0644)
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	Source      string  `xml:"category,omitempty"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
 }
 
-func listJSONItems(path string) []map[string]any {
-	var arr []map[string]any
-	if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
-		_ = json.Unmarshal(b, &arr)
+// smartFeedRSSHandler sirve un smart feed como RSS: GET /smart/<token>.xml.
+// No necesita sesión (el token hace de contraseña) para poder suscribirse
+// desde otro lector; incluye también los artículos ya leídos.
+func smartFeedRSSHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/smart/"), ".xml")
+	username, smart, err := store.SmartFeedByToken(token)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	articles := riverArticles(username, riverFilter{ShowAll: true})
+	articles = matchSmartFeed(username, *smart, articles)
+	if len(articles) > SMART_FEED_RSS_ITEMS {
+		articles = articles[:SMART_FEED_RSS_ITEMS]
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	rss := rssDocument{Version: "2.0", Channel: rssChannel{
+		Title:       smart.Name + " · ANCAP WEB",
+		Link:        scheme + "://" + r.Host + "/?smart=" + url.QueryEscape(smart.ID),
+		Description: smart.Query,
+	}}
+	for _, a := range articles {
+		item := rssItem{
+			Title:       a.Title,
+			Link:        a.Link,
+			GUID:        rssGUID{Value: a.ID},
+			Source:      a.Source, // riverArticles ya puso el riverSourceName del feed
+			Description: a.Description,
+		}
+		if t := a.SortTime(); !t.IsZero() {
+			item.PubDate = t.UTC().Format(time.RFC1123Z)
+		}
+		rss.Channel.Items = append(rss.Channel.Items, item)
+	}
+	xmlData, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		log.Printf("❌ Error creating smart feed RSS: %v", err)
+		http.Error(w, "Error creating RSS", http.StatusInternalServerError)
+		return
 	}
-	return arr
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n"))
+	w.Write(xmlData)
 }
 
 // ==========================
-// Persistencia de artículos ya "cargados" por sesión (por usuario)
+// Reglas de filtrado
 // ==========================
-func loadLoadedArticlesSet(username string) map[string]bool {
-	path := username + "_loaded.json"
-	var arr []string
-	if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
-		_ = json.Unmarshal(b, &arr)
+
+// applyFilterRules aplica a los artículos nuevos de feedURL las reglas de
+// cada usuario suscrito: marcas (silenciar, leído, prioridad, etiquetas) y
+// guardado en SAVED/LOVED.
+func applyFilterRules(feedURL string, articles []Article) {
+	if len(articles) == 0 {
+		return
 	}
-	set := make(map[string]bool, len(arr))
-	for _, s := range arr {
-		set[s] = true
+	users, err := store.ListUsers()
+	if err != nil {
+		log.Printf("❌ Error listing users for rules: %v", err)
+		return
 	}
-	return set
-}
+	for _, user := range users {
+		username := user.Username
+		feeds := loadFeedsForUser(username)
+		i := slices.IndexFunc(feeds, func(feed Feed) bool {
+			return feed.URL == feedURL
+		})
+		if i < 0 {
+			continue
+		}
+		// Las reglas ven la fuente con el mismo nombre que el río (y que la
+		// prueba de /api/rules/dry-run)
+		source := riverSourceName(feeds[i])
+		list, err := store.ListRules(username)
+		if err != nil {
+			log.Printf("❌ Error loading rules for %s: %v", username, err)
+			continue
+		}
+		set, err := rules.CompileAll(list)
+		if err != nil {
+			log.Printf("⚠️ Skipping invalid rules for %s: %v", username, err)
+		}
+		if len(set) == 0 {
+			continue
+		}
 
-func saveLoadedArticlesSet(username string, set map[string]bool) {
-	arr := make([]string, 0, len(set))
-	for k := range set {
-		arr = append(arr, k)
+		marks := make(map[string]storage.ArticleMark)
+		for _, a := range articles {
+			if source != "" {
+				a.Source = source
+			}
+			outcome := set.Evaluate(a)
+			if len(outcome.Rules) == 0 {
+				continue
+			}
+			mark := outcome.Mark
+			if mark.Hidden || mark.Read || mark.Priority || len(mark.Tags) > 0 {
+				marks[a.ID] = mark
+			}
+			item := storage.ListItem{Title: a.Title, Link: a.Link, Source: a.Source, User: username}
+			for list, on := range map[string]bool{"saved": outcome.Save, "loved": outcome.Love} {
+				if !on {
+					continue
+				}
+				added, err := store.ImportListItems(username, list, []storage.ListItem{item})
+				if err != nil {
+					log.Printf("❌ Error saving %s item for %s: %v", list, username, err)
+					continue
+				}
+				if added > 0 {
+					indexListItem(username, item, time.Now().UTC())
+					go archiveArticle(item.Link, item.Title)
+				}
+			}
+		}
+		if err := store.MarkArticles(username, marks); err != nil {
+			log.Printf("❌ Error applying rules for %s: %v", username, err)
+			continue
+		}
+		if len(marks) > 0 {
+			log.Printf("🏷️ Rules marked %d new articles from %s for %s", len(marks), feedURL, username)
+		}
 	}
-	b, _ := json.MarshalIndent(arr, "", "  ")
-	_ = os.WriteFile(username+"_loaded.json", b, 0644)
 }
 
-func saveListHandler(listName string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// rulesHandler gestiona las reglas del usuario: GET las lista, POST crea
+// una (o la modifica si lleva "id") y DELETE ?id= la borra.
+func rulesHandler(w http.ResponseWriter, r *http.Request) {
+	username := getUserFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		list, err := store.ListRules(username)
+		if err != nil {
+			log.Printf("❌ Error loading rules for %s: %v", username, err)
+			http.Error(w, "Failed to load rules", http.StatusInternalServerError)
 			return
 		}
-		username := getUserFromRequest(r)
-		var req struct{ Title, Link, Source string }
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Link == "" {
+		if list == nil {
+			list = []storage.Rule{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		// enabled es opcional: al crear la regla vale true y al editarla se
+		// conserva el valor guardado
+		var req struct {
+			storage.Rule
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
-		path := username + "_" + listName + ".json"
-		item := map[string]any{"title": req.Title, "link": req.Link, "source": req.Source, "user": username}
-		if err := appendJSONItem(path, item); err != nil {
+		rule := rules.Normalize(req.Rule)
+		if _, err := rules.Compile(rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rule.Name == "" {
+			rule.Name = rule.Pattern
+		}
+		if rule.ID == "" {
+			id := make([]byte, 8)
+			if _, err := rand.Read(id); err != nil {
+				http.Error(w, "Failed to create rule", http.StatusInternalServerError)
+				return
+			}
+			rule.ID = hex.EncodeToString(id)
+			rule.Created = time.Now().UTC()
+			rule.Enabled = true
+		} else {
+			list, _ := store.ListRules(username)
+			i := slices.IndexFunc(list, func(existing storage.Rule) bool { return existing.ID == rule.ID })
+			if i < 0 {
+				http.Error(w, "Rule not found", http.StatusNotFound)
+				return
+			}
+			rule.Created = list[i].Created
+			rule.Enabled = list[i].Enabled
+		}
+		if req.Enabled != nil {
+			rule.Enabled = *req.Enabled
+		}
+		if err := store.SaveRule(username, rule); err != nil {
+			log.Printf("❌ Error saving rule for %s: %v", username, err)
 			http.Error(w, "Failed to save", http.StatusInternalServerError)
 			return
 		}
+		log.Printf("🏷️ Rule %q (%s %s %q -> %s) saved for %s", rule.Name, rule.Field, rule.Match, rule.Pattern, strings.Join(rule.Actions, ","), username)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodDelete:
+		found, err := store.DeleteRule(username, r.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("❌ Error deleting rule for %s: %v", username, err)
+			http.Error(w, "Failed to delete", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"success": true})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func listHandler(listName string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		username := getUserFromRequest(r)
-		path := username + "_" + listName + ".json"
-		items := listJSONItems(path)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(items)
+// ruleDryRunHandler prueba una regla sin guardarla ni aplicarla:
+// POST /api/rules/dry-run con la regla (o {"id"} de una guardada) devuelve
+// los artículos del río, leídos y silenciados incluidos, que habría marcado.
+func ruleDryRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	username := getUserFromRequest(r)
+	var rule storage.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if rule.ID != "" && rule.Pattern == "" {
+		list, _ := store.ListRules(username)
+		i := slices.IndexFunc(list, func(existing storage.Rule) bool { return existing.ID == rule.ID })
+		if i < 0 {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		rule = list[i]
+	}
+	compiled, err := rules.Compile(rules.Normalize(rule))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type match struct {
+		ID        string    `json:"id"`
+		Title     string    `json:"title"`
+		Link      string    `json:"link"`
+		Source    string    `json:"source"`
+		Published time.Time `json:"published"`
+	}
+	articles := riverArticles(username, riverFilter{ShowAll: true, Muted: true})
+	matches := []match{}
+	for _, a := range articles {
+		if compiled.Matches(a) {
+			matches = append(matches, match{ID: a.ID, Title: a.Title, Link: a.Link, Source: a.Source, Published: a.SortTime()})
+		}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"rule":    compiled.Rule,
+		"checked": len(articles),
+		"count":   len(matches),
+		"matches": matches,
+	})
 }
 
 func clearCacheHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("🧹 Clear cache handler called")
-	globalCache.mutex.Lock()
-	globalCache.feeds = make(map[string]CachedFeed)
-	globalCache.mutex.Unlock()
-	log.Printf("✅ Cache cleared successfully")
+	feedScheduler.ForceRefresh()
+	log.Printf("✅ Cache cleared successfully, all feeds scheduled for refresh")
 	w.Write([]byte("Cache cleared successfully"))
 }
 
@@ -2496,35 +5355,15 @@ func scrapeArticleHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("🔍 Attempting to scrape article: %s", request.URL)
 
-	// Verificar primero si está en cache
-	articleContentCache.mutex.RLock()
-	cached, exists := articleContentCache.articles[request.URL]
-	articleContentCache.mutex.RUnlock()
-
-	var content string
-	var err error
-
-	if exists && cached.Success && time.Since(cached.Timestamp) < 30*time.Minute {
-		// Usar contenido del cache
-		content = cached.Content
+	content, cached, err := articleContent(request.URL)
+	if err != nil {
+		log.Printf("❌ Error scraping article: %v", err)
+		http.Error(w, "Could not scrape article", http.StatusInternalServerError)
+		return
+	}
+	if cached {
 		log.Printf("🟢 Cache HIT para artículo: %s", request.URL)
 	} else {
-		// Hacer scraping y guardar en cache
-		content, err = scrapeArticleContent(request.URL)
-		if err != nil {
-			log.Printf("❌ Error scraping article: %v", err)
-			http.Error(w, "Could not scrape article", http.StatusInternalServerError)
-			return
-		}
-
-		// Guardar en cache
-		articleContentCache.mutex.Lock()
-		articleContentCache.articles[request.URL] = CachedArticleContent{
-			Content:   content,
-			Timestamp: time.Now(),
-			Success:   true,
-		}
-		articleContentCache.mutex.Unlock()
 		log.Printf("🔴 Cache MISS - scraped y guardado: %s", request.URL)
 	}
 
@@ -2545,191 +5384,152 @@ func scrapeArticleHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("✅ Successfully scraped article content (%d characters)", len(content))
 }
 
-func scrapeArticleContent(url string) (string, error) {
-	// Crear cliente HTTP con timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Hacer request a la URL del artículo
-	resp, err := client.Get(url)
+// contentCacheKey normaliza la URL de un artículo para la caché de
+// contenido: mismas reglas que las URLs de feeds y, además, sin parámetros
+// de seguimiento (utm_*, fbclid...) y con la query ordenada.
+func contentCacheKey(link string) string {
+	normalized, err := normalizeFeedURL(link)
 	if err != nil {
-		return "", fmt.Errorf("error fetching URL: %v", err)
+		return strings.TrimSpace(link)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("non-200 status code: %d", resp.StatusCode)
+	u, err := url.Parse(normalized)
+	if err != nil || u.RawQuery == "" {
+		return normalized
 	}
-
-	// Leer el contenido HTML
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %v", err)
+	query := u.Query()
+	for name := range query {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "utm_") || lower == "fbclid" || lower == "gclid" || lower == "mc_cid" || lower == "mc_eid" {
+			query.Del(name)
+		}
 	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
 
-	// Convertir a string
-	html := string(body)
+// contentRetryDelay es lo que se espera antes de reintentar una extracción
+// que ha fallado failures veces seguidas: se duplica en cada fallo.
+func contentRetryDelay(failures int) time.Duration {
+	delay := CONTENT_RETRY_BACKOFF
+	for i := 1; i < failures && delay < CONTENT_MAX_RETRY_BACKOFF; i++ {
+		delay *= 2
+	}
+	return min(delay, CONTENT_MAX_RETRY_BACKOFF)
+}
 
-	// Extraer el contenido principal usando selectores comunes
-	content := extractMainContent(html)
+// Extracciones en curso, para que la precarga y el lector no descarguen a
+// la vez la misma página
+var contentInFlight = struct {
+	sync.Mutex
+	calls map[string]chan struct{}
+}{calls: make(map[string]chan struct{})}
+
+// articleContent devuelve el contenido extraído de link. Sale de la caché
+// en disco (cached=true) salvo que no esté, haya caducado o sea un fallo
+// cuyo reintento ya toque; los fallos recientes se devuelven como error
+// sin volver a descargar.
+func articleContent(link string) (content string, cached bool, err error) {
+	key := contentCacheKey(link)
+	for {
+		entry, err := store.GetContent(key)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("⚠️ Error reading content cache for %s: %v", key, err)
+		}
+		if entry != nil {
+			age := time.Since(entry.FetchedAt)
+			if entry.Error == "" && age < contentCacheTTL {
+				return entry.Content, true, nil
+			}
+			if entry.Error != "" && age < contentRetryDelay(entry.Failures) {
+				return "", true, fmt.Errorf("%s failed %d times, last %v ago: %s", key, entry.Failures, age.Round(time.Second), entry.Error)
+			}
+		}
 
-	// Limpiar y formatear el contenido
-	content = cleanScrapedContent(content)
+		contentInFlight.Lock()
+		if wait, busy := contentInFlight.calls[key]; busy {
+			contentInFlight.Unlock()
+			// Otra petición la está descargando: esperar y leer su resultado
+			<-wait
+			continue
+		}
+		done := make(chan struct{})
+		contentInFlight.calls[key] = done
+		contentInFlight.Unlock()
 
-	// Ser más tolerante con el contenido corto
-	if len(content) < 50 {
-		// Intentar extraer al menos el título y algo de contenido
-		titleContent := extractTitleAndMeta(html)
-		if len(titleContent) > 20 {
-			content = titleContent
+		content, err = scrapeArticleContent(link)
+		result := storage.CachedContent{URL: key, Content: content, FetchedAt: time.Now().UTC()}
+		if err != nil {
+			result.Error = err.Error()
+			result.Failures = 1
+			if entry != nil {
+				result.Failures = entry.Failures + 1
+			}
 		} else {
-			return "", fmt.Errorf("extracted content too short (%d chars), probably failed", len(content))
+			setSearchContent(link, content)
 		}
-	}
-
-	return content, nil
-}
-
-func extractMainContent(html string) string {
-	// Selectores comunes para contenido principal
-	contentSelectors := []string{
-		`<article[^>]*>([\s\S]*?)</article>`,
-		`<div[^>]*class[^>]*["'].*?content.*?["'][^>]*>([\s\S]*?)</div>`,
-		`<div[^>]*class[^>]*["'].*?post.*?["'][^>]*>([\s\S]*?)</div>`,
-		`<div[^>]*class[^>]*["'].*?entry.*?["'][^>]*>([\s\S]*?)</div>`,
-		`<div[^>]*class[^>]*["'].*?main.*?["'][^>]*>([\s\S]*?)</div>`,
-		`<main[^>]*>([\s\S]*?)</main>`,
-	}
-
-	// Intentar cada selector
-	for _, selector := range contentSelectors {
-		re := regexp.MustCompile(selector)
-		matches := re.FindStringSubmatch(html)
-		if len(matches) > 1 && len(matches[1]) > 100 {
-			return matches[1]
+		evicted, putErr := store.PutContent(result, contentCacheMaxBytes)
+		if putErr != nil {
+			log.Printf("❌ Error saving content cache for %s: %v", key, putErr)
+		} else if evicted > 0 {
+			log.Printf("🧹 Content cache full, evicted %d articles", evicted)
 		}
-	}
 
-	// Fallback: extraer entre <body> tags
-	bodyRe := regexp.MustCompile(`<body[^>]*>([\s\S]*?)</body>`)
-	matches := bodyRe.FindStringSubmatch(html)
-	if len(matches) > 1 {
-		return matches[1]
+		contentInFlight.Lock()
+		delete(contentInFlight.calls, key)
+		contentInFlight.Unlock()
+		close(done)
+		return content, false, err
 	}
-
-	return html
 }
 
-func extractTitleAndMeta(html string) string {
-	// Fallback: extraer al menos título y meta descripción
-	var content strings.Builder
+// utf8HTMLBody devuelve hasta limit bytes del cuerpo de resp convertidos a
+// UTF-8. La codificación sale del BOM, del charset de Content-Type o del
+// <meta charset> de la página, por ese orden; si no hay ninguno se adivina
+// (UTF-8 si es válido, si no Windows-1252, lo habitual en webs antiguas).
+// Las entidades HTML (&eacute;, &#8217;...) las decodifica después el
+// parser de HTML.
+func utf8HTMLBody(resp *http.Response, limit int64) (io.Reader, error) {
+	return charset.NewReader(io.LimitReader(resp.Body, limit), resp.Header.Get("Content-Type"))
+}
 
-	// Extraer título
-	titleRe := regexp.MustCompile(`<title[^>]*>([^<]+)</title>`)
-	if matches := titleRe.FindStringSubmatch(html); len(matches) > 1 {
-		content.WriteString("# ")
-		content.WriteString(strings.TrimSpace(matches[1]))
-		content.WriteString("\n\n")
+func scrapeArticleContent(url string) (string, error) {
+	// Crear cliente HTTP con timeout
+	client := &http.Client{
+		Timeout: 10 * time.Second,
 	}
 
-	// Extraer meta descripción
-	metaRe := regexp.MustCompile(`<meta[^>]*name=["\']description["\'][^>]*content=["\']([^"\']+)["\']`)
-	if matches := metaRe.FindStringSubmatch(html); len(matches) > 1 {
-		content.WriteString(strings.TrimSpace(matches[1]))
-		content.WriteString("\n\n")
+	// Hacer request a la URL del artículo
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("error fetching URL: %v", err)
 	}
+	defer resp.Body.Close()
 
-	// Extraer algunos párrafos del contenido
-	pRe := regexp.MustCompile(`<p[^>]*>([^<]{20,200})</p>`)
-	matches := pRe.FindAllStringSubmatch(html, 3)
-	for _, match := range matches {
-		if len(match) > 1 {
-			cleanP := strings.TrimSpace(match[1])
-			if len(cleanP) > 20 {
-				content.WriteString(cleanP)
-				content.WriteString("\n\n")
-			}
-		}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("non-200 status code: %d", resp.StatusCode)
 	}
 
-	return content.String()
-}
-
-func cleanScrapedContent(content string) string {
-	// Remover scripts y styles
-	scriptRe := regexp.MustCompile(`<script[^>]*>[\s\S]*?</script>`)
-	content = scriptRe.ReplaceAllString(content, "")
-
-	styleRe := regexp.MustCompile(`<style[^>]*>[\s\S]*?</style>`)
-	content = styleRe.ReplaceAllString(content, "")
-
-	// Remover comentarios HTML
-	commentRe := regexp.MustCompile(`<!--[\s\S]*?-->`)
-	content = commentRe.ReplaceAllString(content, "")
-
-	// Remover navegación y elementos comunes no deseados
-	unwantedSelectors := []string{
-		`<nav[^>]*>[\s\S]*?</nav>`,
-		`<header[^>]*>[\s\S]*?</header>`,
-		`<footer[^>]*>[\s\S]*?</footer>`,
-		`<div[^>]*class[^>]*["'].*?nav.*?["'][^>]*>[\s\S]*?</div>`,
-		`<div[^>]*class[^>]*["'].*?menu.*?["'][^>]*>[\s\S]*?</div>`,
-		`<div[^>]*class[^>]*["'].*?sidebar.*?["'][^>]*>[\s\S]*?</div>`,
-		`<div[^>]*class[^>]*["'].*?advertisement.*?["'][^>]*>[\s\S]*?</div>`,
-		`<div[^>]*class[^>]*["'].*?ads.*?["'][^>]*>[\s\S]*?</div>`,
+	body, err := utf8HTMLBody(resp, 5<<20)
+	if err != nil {
+		return "", fmt.Errorf("error decoding response body: %v", err)
 	}
 
-	for _, selector := range unwantedSelectors {
-		re := regexp.MustCompile(selector)
-		content = re.ReplaceAllString(content, "")
+	// Extraer el cuerpo del artículo como HTML saneado; los enlaces e
+	// imágenes relativos se resuelven contra la URL final (tras redirecciones)
+	article, err := readability.Extract(body, resp.Request.URL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing HTML: %v", err)
 	}
 
-	// Convertir algunas etiquetas HTML a texto plano con mejor formato
-	content = strings.ReplaceAll(content, "<br>", "\n")
-	content = strings.ReplaceAll(content, "<br/>", "\n")
-	content = strings.ReplaceAll(content, "<br />", "\n")
-	content = strings.ReplaceAll(content, "</p>", "\n\n")
-	content = strings.ReplaceAll(content, "<p>", "")
-	content = strings.ReplaceAll(content, "</div>", "\n")
-	content = strings.ReplaceAll(content, "</h1>", "\n\n")
-	content = strings.ReplaceAll(content, "</h2>", "\n\n")
-	content = strings.ReplaceAll(content, "</h3>", "\n\n")
-	content = strings.ReplaceAll(content, "</h4>", "\n\n")
-	content = strings.ReplaceAll(content, "</h5>", "\n\n")
-	content = strings.ReplaceAll(content, "</h6>", "\n\n")
-	content = strings.ReplaceAll(content, "<h1>", "\n\n")
-	content = strings.ReplaceAll(content, "<h2>", "\n\n")
-	content = strings.ReplaceAll(content, "<h3>", "\n\n")
-	content = strings.ReplaceAll(content, "<h4>", "\n\n")
-	content = strings.ReplaceAll(content, "<h5>", "\n\n")
-	content = strings.ReplaceAll(content, "<h6>", "\n\n")
-
-	// Remover todas las etiquetas HTML restantes
-	htmlTagRe := regexp.MustCompile(`<[^>]*>`)
-	content = htmlTagRe.ReplaceAllString(content, "")
-
-	// Decodificar entidades HTML comunes
-	content = strings.ReplaceAll(content, "&amp;", "&")
-	content = strings.ReplaceAll(content, "&lt;", "<")
-	content = strings.ReplaceAll(content, "&gt;", ">")
-	content = strings.ReplaceAll(content, "&quot;", "\"")
-	content = strings.ReplaceAll(content, "&#39;", "'")
-	content = strings.ReplaceAll(content, "&nbsp;", " ")
-
-	// Limpiar espacios en blanco excesivos
-	spaceRe := regexp.MustCompile(`[ \t]+`)
-	content = spaceRe.ReplaceAllString(content, " ")
-
-	// Limpiar saltos de línea excesivos pero mantener párrafos
-	newlineRe := regexp.MustCompile(`\n\s*\n\s*\n+`)
-	content = newlineRe.ReplaceAllString(content, "\n\n")
-
-	// Remover espacios al inicio y final de líneas
-	lineCleanRe := regexp.MustCompile(`(?m)^[ \t]+|[ \t]+$`)
-	content = lineCleanRe.ReplaceAllString(content, "")
+	// Ser más tolerante con el contenido corto: al menos la entradilla
+	if article.Length < 50 {
+		if len(article.Excerpt) > 20 {
+			return "<p>" + html.EscapeString(article.Excerpt) + "</p>", nil
+		}
+		return "", fmt.Errorf("extracted content too short (%d chars), probably failed", article.Length)
+	}
 
-	return strings.TrimSpace(content)
+	return article.Content, nil
 }
 
 func staticHandler(w http.ResponseWriter, r *http.Request) {
@@ -2746,30 +5546,22 @@ func preloadFeedsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Cargar feeds en segundo plano y llenar cache
-	feeds := loadFeeds()
-	var wg sync.WaitGroup
-
-	for _, feed := range feeds {
-		wg.Add(1)
-		go func(feedURL string) {
-			defer wg.Done()
-			// Esto llenará el cache
-			fetchFeedArticles(feedURL)
-		}(feed.URL)
+	// Adelantar la pasada del planificador; sólo se descargan los feeds vencidos
+	urls, err := store.DistinctFeedURLs()
+	if err != nil {
+		log.Printf("❌ Error listing feeds: %v", err)
 	}
-
-	wg.Wait()
+	feedScheduler.Wake()
 
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]interface{}{
 		"status":      "success",
-		"message":     "Feeds precargados en cache",
-		"feeds_count": len(feeds),
+		"message":     "Actualización de feeds programada",
+		"feeds_count": len(urls),
 	}
 
 	json.NewEncoder(w).Encode(response)
-	log.Printf("✅ Feeds precargados exitosamente (%d feeds)", len(feeds))
+	log.Printf("✅ Feed refresh scheduled (%d feeds)", len(urls))
 }
 
 func loginPageHandler(w http.ResponseWriter, r *http.Request) {
@@ -3241,49 +6033,136 @@ func loginAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var loginReq struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	var loginReq struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if validateLogin(loginReq.Username, loginReq.Password) {
+		sessionID, err := createSession(loginReq.Username, r)
+		if err != nil {
+			log.Printf("❌ Error creating session for %s: %v", loginReq.Username, err)
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+
+		// Crear cookie de sesión
+		http.SetCookie(w, sessionCookie(sessionID, time.Now().Add(SESSION_DURATION)))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Login exitoso",
+		})
+
+		log.Printf("✅ Login exitoso para usuario: %s", loginReq.Username)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Credenciales inválidas",
+		})
+
+		log.Printf("❌ Login fallido para usuario: %s", loginReq.Username)
+	}
+}
+
+// Emite un par de tokens (JWT de acceso + refresh token) para la API
+func issueTokenPair(w http.ResponseWriter, r *http.Request, username string) {
+	access, err := authService.GenerateToken(&auth.User{ID: username, Username: username})
+	if err != nil {
+		log.Printf("❌ Error generating token for %s: %v", username, err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	refresh, refreshExpires, err := newStoredSession(username, storage.SessionRefresh, refreshTokenDuration, r)
+	if err != nil {
+		log.Printf("❌ Error creating refresh token for %s: %v", username, err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":       access.Token,
+		"token_type":         "Bearer",
+		"expires_at":         access.ExpiresAt,
+		"expires_in":         access.ExpiresAt - time.Now().Unix(),
+		"refresh_token":      refresh,
+		"refresh_expires_at": refreshExpires.Unix(),
+	})
+}
+
+// Handler para obtener un token JWT con usuario y contraseña
+func tokenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !validateLogin(req.Username, req.Password) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"success": false, "error": "Credenciales inválidas"})
+		log.Printf("❌ Token request failed for user: %s", req.Username)
+		return
+	}
+
+	issueTokenPair(w, r, req.Username)
+	log.Printf("🔑 Token issued for user: %s", req.Username)
+}
+
+// Handler para renovar el token de acceso. El refresh token se rota: el
+// usado queda revocado y se emite uno nuevo.
+func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if validateLogin(loginReq.Username, loginReq.Password) {
-		sessionID := createSession(loginReq.Username)
-
-		// Crear cookie de sesión
-		cookie := &http.Cookie{
-			Name:     "session_id",
-			Value:    sessionID,
-			Expires:  time.Now().Add(SESSION_DURATION),
-			HttpOnly: true,
-			Path:     "/",
-		}
-		http.SetCookie(w, cookie)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "Login exitoso",
-		})
-
-		log.Printf("✅ Login exitoso para usuario: %s", loginReq.Username)
-	} else {
+	username, valid := validateStoredSession(req.RefreshToken, storage.SessionRefresh)
+	if !valid {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Credenciales inválidas",
-		})
-
-		log.Printf("❌ Login fallido para usuario: %s", loginReq.Username)
+		json.NewEncoder(w).Encode(map[string]any{"success": false, "error": "Invalid or expired refresh token"})
+		return
+	}
+	if err := store.DeleteSession(sessionKey(req.RefreshToken)); err != nil {
+		log.Printf("❌ Error revoking refresh token for %s: %v", username, err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
 	}
+
+	issueTokenPair(w, r, username)
+	log.Printf("🔄 Token refreshed for user: %s", username)
 }
 
-// Registro de usuario simple (almacenado en users.json)
+// Registro de usuario simple
 func registerAPIHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -3306,16 +6185,20 @@ func registerAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	users := loadUsers()
-	for _, u := range users {
-		if u.Username == req.Username {
-			http.Error(w, "User already exists", http.StatusConflict)
-			return
-		}
+	hash, err := authService.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("❌ Error hashing password for %s: %v", req.Username, err)
+		http.Error(w, "Failed to save user", http.StatusInternalServerError)
+		return
 	}
 
-	users = append(users, User{Username: req.Username, Password: req.Password})
-	if err := saveUsers(users); err != nil {
+	err = store.CreateUser(User{Username: req.Username, Password: hash})
+	if err == storage.ErrExists {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error creating user %s: %v", req.Username, err)
 		http.Error(w, "Failed to save user", http.StatusInternalServerError)
 		return
 	}
@@ -3327,24 +6210,112 @@ func registerAPIHandler(w http.ResponseWriter, r *http.Request) {
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("session_id")
 	if err == nil {
-		sessionMutex.Lock()
-		delete(sessions, cookie.Value)
-		sessionMutex.Unlock()
+		if err := store.DeleteSession(sessionKey(cookie.Value)); err != nil {
+			log.Printf("❌ Error deleting session: %v", err)
+		}
 	}
 
 	// Eliminar cookie
-	deleteCookie := &http.Cookie{
-		Name:     "session_id",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-		Path:     "/",
-	}
-	http.SetCookie(w, deleteCookie)
+	http.SetCookie(w, sessionCookie("", time.Now().Add(-1*time.Hour)))
 
 	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
 }
 
+// Handler para listar las sesiones activas del usuario
+func sessionsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUserFromRequest(r)
+	sessions, err := store.ListSessions(username)
+	if err != nil {
+		log.Printf("❌ Error listing sessions for %s: %v", username, err)
+		http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := ""
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		currentID = sessionKey(cookie.Value)
+	}
+
+	type sessionInfo struct {
+		Session
+		Current bool `json:"current"`
+	}
+	now := time.Now()
+	active := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if now.After(session.Expires) {
+			continue
+		}
+		active = append(active, sessionInfo{Session: session, Current: session.ID == currentID})
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Created.After(active[j].Created)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(active)
+}
+
+// Handler para revocar una sesión propia (o todas salvo la actual)
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		ID     string `json:"id"`
+		Others bool   `json:"others"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || (request.ID == "" && !request.Others) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	username := getUserFromRequest(r)
+	sessions, err := store.ListSessions(username)
+	if err != nil {
+		log.Printf("❌ Error listing sessions for %s: %v", username, err)
+		http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := ""
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		currentID = sessionKey(cookie.Value)
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if request.Others && session.ID == currentID {
+			continue
+		}
+		if !request.Others && session.ID != request.ID {
+			continue
+		}
+		if err := store.DeleteSession(session.ID); err != nil {
+			log.Printf("❌ Error revoking session for %s: %v", username, err)
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+		revoked++
+	}
+
+	if revoked == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("🔒 Revoked %d session(s) for user %s", revoked, username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "revoked": revoked})
+}
+
 // Handler para obtener la lista de feeds
 func feedsAPIHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
@@ -3359,6 +6330,200 @@ func feedsAPIHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(feeds)
 }
 
+// feedSettingsHandler cambia los ajustes de una suscripción:
+// POST {"url": "...", "max_items": 20, "name": "...", "category": "..."}.
+// Sólo se cambian los campos presentes; max_items 0 vuelve al valor por
+// defecto y un nombre vacío al título del feed.
+func feedSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		URL      string  `json:"url"`
+		MaxItems *int    `json:"max_items"`
+		Name     *string `json:"name"`
+		Category *string `json:"category"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		http.Error(w, "url required", http.StatusBadRequest)
+		return
+	}
+	if req.MaxItems != nil && (*req.MaxItems < 0 || *req.MaxItems > MAX_FEED_MAX_ITEMS) {
+		http.Error(w, fmt.Sprintf("max_items must be between 0 and %d", MAX_FEED_MAX_ITEMS), http.StatusBadRequest)
+		return
+	}
+
+	username := getUserFromRequest(r)
+	var updated Feed
+	err := store.UpdateFeed(username, req.URL, func(feed *Feed) error {
+		if req.MaxItems != nil {
+			feed.MaxItems = *req.MaxItems
+		}
+		if req.Name != nil {
+			feed.CustomName = strings.TrimSpace(*req.Name)
+		}
+		if req.Category != nil {
+			feed.Category = strings.TrimSpace(*req.Category)
+		}
+		updated = *feed
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error saving feed settings for %s: %v", username, err)
+		http.Error(w, "Error saving feeds", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("⚙️ Feed settings updated for %s: %s", username, req.URL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// Handler con el estado de salud de los feeds del usuario
+func feedHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type feedHealth struct {
+		URL                 string     `json:"url"`
+		Name                string     `json:"name"`
+		CustomName          string     `json:"custom_name,omitempty"`
+		Category            string     `json:"category,omitempty"`
+		SiteURL             string     `json:"site_url,omitempty"`
+		FaviconURL          string     `json:"favicon_url,omitempty"`
+		Active              bool       `json:"active"`
+		MaxItems            int        `json:"max_items"`
+		Status              string     `json:"status"`
+		LastFetch           *time.Time `json:"last_fetch,omitempty"`
+		LastSuccess         *time.Time `json:"last_success,omitempty"`
+		NextFetch           *time.Time `json:"next_fetch,omitempty"`
+		LastError           string     `json:"last_error,omitempty"`
+		ConsecutiveFailures int        `json:"consecutive_failures"`
+		HTTPStatus          int        `json:"http_status,omitempty"`
+	}
+
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	username := getUserFromRequest(r)
+	feeds := loadFeedsForUser(username)
+	report := make([]feedHealth, 0, len(feeds))
+	for _, feed := range feeds {
+		health := feedHealth{
+			URL:        feed.URL,
+			Name:       feed.DisplayName(),
+			CustomName: feed.CustomName,
+			Category:   feed.Category,
+			SiteURL:    feed.SiteURL,
+			FaviconURL: feed.FaviconURL,
+			Active:     feed.Active,
+			MaxItems:   feedItemLimit(feed),
+			Status:     "pending",
+		}
+		if state, err := store.GetFeedState(feed.URL); err == nil {
+			health.LastFetch = optionalTime(state.LastFetch)
+			health.LastSuccess = optionalTime(state.LastSuccess)
+			health.NextFetch = optionalTime(state.NextFetch)
+			health.LastError = state.LastError
+			health.ConsecutiveFailures = state.ConsecutiveFailures
+			health.HTTPStatus = state.HTTPStatus
+			if state.ConsecutiveFailures > 0 {
+				health.Status = "failing"
+			} else if !state.LastSuccess.IsZero() {
+				health.Status = "ok"
+			}
+		}
+		if !feed.Active {
+			health.Status = "inactive"
+		}
+		report = append(report, health)
+	}
+
+	// Primero los feeds rotos
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].ConsecutiveFailures > report[j].ConsecutiveFailures
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// userLocation devuelve la zona horaria elegida por el usuario, o la del
+// servidor si no tiene ninguna (o ya no es válida).
+func userLocation(username string) (string, *time.Location) {
+	user, err := store.GetUser(username)
+	if err != nil || user.Timezone == "" {
+		return "", time.Local
+	}
+	location, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		log.Printf("⚠️ Invalid timezone %q for %s: %v", user.Timezone, username, err)
+		return "", time.Local
+	}
+	return user.Timezone, location
+}
+
+// preferencesHandler lee (GET) o actualiza (POST {"timezone": "..."}) las
+// preferencias del usuario.
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	username := getUserFromRequest(r)
+	var timezone string
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := store.GetUser(username)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		timezone = user.Timezone
+	case http.MethodPost:
+		var req struct {
+			Timezone string `json:"timezone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Timezone = strings.TrimSpace(req.Timezone)
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		err := store.UpdateUser(username, func(u *User) error {
+			u.Timezone = req.Timezone
+			return nil
+		})
+		if err == storage.ErrNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Error saving preferences for %s: %v", username, err)
+			http.Error(w, "Error saving preferences", http.StatusInternalServerError)
+			return
+		}
+		timezone = req.Timezone
+		log.Printf("🕐 Timezone for %s set to %s", username, timezone)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"timezone": timezone})
+}
+
 // Handler para verificar el estado de un feed
 func checkFeedHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -3452,10 +6617,10 @@ func uploadOPMLHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("📋 User %s has %d existing feeds", username, len(feeds))
 
-	// Recopilar todos los feeds de forma recursiva
-	var allFeeds []string
+	// Recopilar todos los feeds de forma recursiva, con la carpeta como categoría
+	var allFeeds []Feed
 	for _, outline := range opml.Body.Outlines {
-		collectFeedsRecursive(outline, &allFeeds)
+		collectFeedsRecursive(outline, nil, &allFeeds)
 	}
 
 	log.Printf("🔍 Found %d total feeds in OPML (including nested)", len(allFeeds))
@@ -3464,44 +6629,89 @@ func uploadOPMLHandler(w http.ResponseWriter, r *http.Request) {
 	imported := 0
 	skipped := 0
 	errors := 0
+	categorized := make(map[string]string)
 
-	for _, feedURL := range allFeeds {
-		if !existingUrls[feedURL] {
-			feed := Feed{
-				URL:    feedURL,
-				Active: true,
-			}
+	for _, feed := range allFeeds {
+		if !existingUrls[feed.URL] {
 			if err := saveFeedForUser(feed, username); err != nil {
-				log.Printf("❌ Error saving imported feed %s: %v", feedURL, err)
+				log.Printf("❌ Error saving imported feed %s: %v", feed.URL, err)
 				errors++
 			} else {
-				log.Printf("✅ Imported feed: %s", feedURL)
+				log.Printf("✅ Imported feed: %s", feed.URL)
 				imported++
-				existingUrls[feedURL] = true
+				existingUrls[feed.URL] = true
 			}
 		} else {
-			log.Printf("⏭️  Skipped existing feed: %s", feedURL)
+			log.Printf("⏭️  Skipped existing feed: %s", feed.URL)
 			skipped++
+			if feed.Category != "" {
+				categorized[feed.URL] = feed.Category
+			}
+		}
+	}
+
+	// Los feeds que ya existían sin categoría toman la de su carpeta
+	for feedURL, category := range categorized {
+		err := store.UpdateFeed(username, feedURL, func(feed *Feed) error {
+			if feed.Category == "" {
+				feed.Category = category
+			}
+			return nil
+		})
+		if err != nil && err != storage.ErrNotFound {
+			log.Printf("❌ Error saving category from OPML for %s: %v", feedURL, err)
 		}
 	}
 
 	log.Printf("🎯 OPML import completed for user %s: %d imported, %d skipped, %d errors", username, imported, skipped, errors)
+	if imported > 0 {
+		feedScheduler.Wake()
+	}
 
 	result := fmt.Sprintf("Successfully imported %d feeds (%d skipped, %d errors)", imported, skipped, errors)
 	w.Write([]byte(result))
 }
 
-// Función recursiva para recopilar todos los feeds del OPML
-func collectFeedsRecursive(outline Outline, feeds *[]string) {
+// Función recursiva para recopilar todos los feeds del OPML. folders es la
+// ruta de carpetas hasta el outline, que se guarda como categoría
+// ("Tech/Go").
+func collectFeedsRecursive(outline Outline, folders []string, feeds *[]Feed) {
+	name := strings.TrimSpace(outline.Text)
+	if name == "" {
+		name = strings.TrimSpace(outline.Title)
+	}
+
 	// Si este outline tiene un xmlUrl, es un feed
 	if outline.XMLURL != "" {
-		*feeds = append(*feeds, outline.XMLURL)
-		log.Printf("🔗 Found feed: %s (%s)", outline.Title, outline.XMLURL)
+		feed := Feed{
+			URL:         strings.TrimSpace(outline.XMLURL),
+			Active:      outline.Disabled != "true",
+			Title:       strings.TrimSpace(outline.Title),
+			SiteURL:     strings.TrimSpace(outline.HTMLURL),
+			Description: strings.TrimSpace(outline.Description),
+			Category:    strings.Join(folders, "/"),
+		}
+		// text es el nombre que ve el usuario; si difiere del título es un
+		// nombre personalizado
+		if feed.Title == "" {
+			feed.Title = name
+		} else if name != feed.Title {
+			feed.CustomName = name
+		}
+		// Sin carpeta, usar el atributo category de OPML 2.0 ("/Tech/Go,otra")
+		if feed.Category == "" && outline.Category != "" {
+			first, _, _ := strings.Cut(outline.Category, ",")
+			feed.Category = strings.Trim(strings.TrimSpace(first), "/")
+		}
+		*feeds = append(*feeds, feed)
+		log.Printf("🔗 Found feed: %s (%s)", name, outline.XMLURL)
+	} else if name != "" {
+		folders = append(folders[:len(folders):len(folders)], name)
 	}
 
 	// Procesar sub-outlines recursivamente
 	for _, subOutline := range outline.Outlines {
-		collectFeedsRecursive(subOutline, feeds)
+		collectFeedsRecursive(subOutline, folders, feeds)
 	}
 } // Handler para exportar feeds a OPML
 func exportOPMLHandler(w http.ResponseWriter, r *http.Request) {
@@ -3522,16 +6732,33 @@ func exportOPMLHandler(w http.ResponseWriter, r *http.Request) {
 		Body: Body{},
 	}
 
-	// Agregar feeds al OPML
+	// Agregar feeds al OPML, anidados en una carpeta por cada nivel de su
+	// categoría. Los inactivos se exportan marcados con disabled="true".
+	exported := 0
 	for _, feed := range feeds {
-		if feed.Active {
-			outline := Outline{
-				Type:   "rss",
-				XMLURL: feed.URL,
-				Title:  feed.URL, // Podríamos mejorar esto obteniendo el título real
+		title := feed.Title
+		if title == "" {
+			title = feed.DisplayName()
+		}
+		outline := Outline{
+			Type:        "rss",
+			Text:        feed.DisplayName(),
+			Title:       title,
+			XMLURL:      feed.URL,
+			HTMLURL:     feed.SiteURL,
+			Description: feed.Description,
+		}
+		if !feed.Active {
+			outline.Disabled = "true"
+		}
+		folder := &opml.Body.Outlines
+		for _, name := range strings.Split(feed.Category, "/") {
+			if name = strings.TrimSpace(name); name != "" {
+				folder = opmlFolder(folder, name)
 			}
-			opml.Body.Outlines = append(opml.Body.Outlines, outline)
 		}
+		*folder = append(*folder, outline)
+		exported++
 	}
 
 	// Convertir a XML
@@ -3550,7 +6777,19 @@ func exportOPMLHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n"))
 	w.Write(xmlData)
 
-	log.Printf("✅ OPML export completed for user %s: %d feeds exported", username, len(opml.Body.Outlines))
+	log.Printf("✅ OPML export completed for user %s: %d feeds exported", username, exported)
+}
+
+// opmlFolder devuelve los hijos de la carpeta name dentro de outlines,
+// creándola si no existe
+func opmlFolder(outlines *[]Outline, name string) *[]Outline {
+	for i := range *outlines {
+		if (*outlines)[i].XMLURL == "" && (*outlines)[i].Text == name {
+			return &(*outlines)[i].Outlines
+		}
+	}
+	*outlines = append(*outlines, Outline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1].Outlines
 }
 
 // Handler para eliminar un feed
@@ -3570,41 +6809,28 @@ func deleteFeedHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	username := getUserFromRequest(r)
-	// Cargar feeds actuales del usuario
-	feeds := loadFeedsForUser(username)
-
-	// Filtrar el feed a eliminar
-	var updatedFeeds []Feed
-	found := false
-	for _, feed := range feeds {
-		if feed.URL != request.URL {
-			updatedFeeds = append(updatedFeeds, feed)
-		} else {
-			found = true
-		}
-	}
-
-	if !found {
+	// Eliminar el feed dentro de una única transacción
+	found, err := store.DeleteFeed(username, request.URL)
+	if err != nil {
 		response := struct {
 			Success bool   `json:"success"`
 			Error   string `json:"error"`
 		}{
 			Success: false,
-			Error:   "Feed not found",
+			Error:   "Failed to save feeds: " + err.Error(),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// Guardar feeds actualizados para el usuario
-	if err := saveFeedsForUser(updatedFeeds, username); err != nil {
+	if !found {
 		response := struct {
 			Success bool   `json:"success"`
 			Error   string `json:"error"`
 		}{
 			Success: false,
-			Error:   "Failed to save feeds: " + err.Error(),
+			Error:   "Feed not found",
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
@@ -3623,13 +6849,113 @@ func deleteFeedHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("🗑️  Feed deleted for user %s: %s", username, request.URL)
 }
 
+// Subcomando "migrate": importa los JSON heredados al almacén
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directorio con los ficheros JSON heredados")
+	fs.Parse(args)
+
+	log.Printf("📦 Migrating legacy JSON files from %s into %s", *dir, DB_PATH)
+	report, err := storage.MigrateLegacyJSON(*dir, store)
+	if err != nil {
+		log.Fatalf("❌ Migration failed: %v", err)
+	}
+
+	usernames := make([]string, 0, len(report.PerUser))
+	for username := range report.PerUser {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	fmt.Printf("users imported:     %d\n", report.Users)
+	fmt.Printf("favorites imported: %d\n", report.Favorites)
+	for _, username := range usernames {
+		c := report.PerUser[username]
+		fmt.Printf("  %-16s feeds=%d saved=%d loved=%d\n", username, c.Feeds, c.Saved, c.Loved)
+	}
+	for _, name := range report.Renamed {
+		fmt.Printf("renamed: %s -> %s%s\n", name, name, storage.MigratedSuffix)
+	}
+	for _, err := range report.Errors {
+		fmt.Printf("error: %v\n", err)
+	}
+
+	// Lo importado (SAVED/LOVED) tiene que poder buscarse aunque el índice
+	// ya exista: reindexAll sólo corre sola cuando se crea
+	searchIndex, _, err = search.Open(SEARCH_INDEX_PATH)
+	if err != nil {
+		log.Fatalf("❌ Error opening search index %s: %v", SEARCH_INDEX_PATH, err)
+	}
+	reindexAll()
+	searchIndex.Close()
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
 func main() {
-	// Limpiar sesiones expiradas cada hora
+	var err error
+	store, err = storage.OpenBolt(DB_PATH)
+	if err != nil {
+		log.Fatalf("❌ Error opening database %s: %v", DB_PATH, err)
+	}
+	defer store.Close()
+
+	jwtSecret, err := loadJWTSecret()
+	if err != nil {
+		log.Fatalf("❌ Error loading JWT secret: %v", err)
+	}
+	authService = auth.NewService(jwtSecret, envDuration("JWT_EXPIRATION", JWT_DEFAULT_EXPIRATION))
+	refreshTokenDuration = envDuration("REFRESH_EXPIRATION", REFRESH_DEFAULT_EXPIRATION)
+	articleStateRetention = envDuration("READ_RETENTION", ARTICLE_STATE_RETENTION)
+	contentCacheTTL = envDuration("CONTENT_CACHE_TTL", CONTENT_CACHE_TTL)
+	if value := os.Getenv("CONTENT_CACHE_MB"); value != "" {
+		if mb, err := strconv.Atoi(value); err == nil && mb > 0 {
+			contentCacheMaxBytes = int64(mb) << 20
+		} else {
+			log.Printf("⚠️ Invalid CONTENT_CACHE_MB=%q, using %d", value, CONTENT_CACHE_MAX_BYTES>>20)
+		}
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	seedDefaultUsers()
+
+	var created bool
+	searchIndex, created, err = search.Open(SEARCH_INDEX_PATH)
+	if err != nil {
+		log.Fatalf("❌ Error opening search index %s: %v", SEARCH_INDEX_PATH, err)
+	}
+	defer searchIndex.Close()
+	if created {
+		// Índice nuevo: indexar lo que ya hay en la base de datos
+		go reindexAll()
+	}
+
+	// Descargar feeds en segundo plano
+	go feedScheduler.Run()
+
+	// Archivar lo pendiente de SAVED/LOVED al arrancar y cada hora
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			archivePending()
+			<-ticker.C
+		}
+	}()
+
+	// Limpiar sesiones expiradas y aplicar la retención de artículos cada hora
 	go func() {
+		pruneArticleData()
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
 			clearExpiredSessions()
+			pruneArticleData()
 		}
 	}()
 
@@ -3664,12 +6990,17 @@ func main() {
 	mux.HandleFunc("/login", loginPageHandler)
 	mux.HandleFunc("/api/login", loginAPIHandler)
 	mux.HandleFunc("/api/register", registerAPIHandler)
+	mux.HandleFunc("/api/token", tokenAPIHandler)
+	mux.HandleFunc("/api/token/refresh", refreshTokenHandler)
 	// listas por usuario
 	mux.Handle("/api/save-saved", authMiddleware(http.HandlerFunc(saveListHandler("saved"))))
 	mux.Handle("/api/save-loved", authMiddleware(http.HandlerFunc(saveListHandler("loved"))))
 	mux.Handle("/api/list-saved", authMiddleware(http.HandlerFunc(listHandler("saved"))))
 	mux.Handle("/api/list-loved", authMiddleware(http.HandlerFunc(listHandler("loved"))))
+	mux.Handle("/api/archive", authMiddleware(http.HandlerFunc(archiveHandler)))
+	mux.Handle("/archive/image/", authMiddleware(http.HandlerFunc(archiveImageHandler)))
 	mux.HandleFunc("/api/preload-feeds", preloadFeedsHandler)
+	mux.HandleFunc("/smart/", smartFeedRSSHandler)
 	mux.HandleFunc("/static/", staticHandler)
 
 	// Rutas protegidas (con autenticación)
@@ -3680,11 +7011,26 @@ func main() {
 	mux.Handle("/api/scrape-article", authMiddleware(http.HandlerFunc(scrapeArticleHandler)))
 	mux.Handle("/api/feeds", authMiddleware(http.HandlerFunc(feedsAPIHandler)))
 	mux.Handle("/api/check-feed", authMiddleware(http.HandlerFunc(checkFeedHandler)))
+	mux.Handle("/api/feeds/health", authMiddleware(http.HandlerFunc(feedHealthHandler)))
+	mux.Handle("/api/feeds/settings", authMiddleware(http.HandlerFunc(feedSettingsHandler)))
+	mux.Handle("/api/articles", authMiddleware(http.HandlerFunc(articlesAPIHandler)))
+	mux.Handle("/api/preferences", authMiddleware(http.HandlerFunc(preferencesHandler)))
 	mux.Handle("/api/delete-feed", authMiddleware(http.HandlerFunc(deleteFeedHandler)))
+	mux.Handle("/api/articles/read", authMiddleware(articleStateHandler(true)))
+	mux.Handle("/api/articles/unread", authMiddleware(articleStateHandler(false)))
+	mux.Handle("/api/articles/read-all", authMiddleware(http.HandlerFunc(markAllReadHandler)))
+	mux.Handle("/api/articles/star", authMiddleware(http.HandlerFunc(starArticleHandler)))
+	mux.Handle("/api/articles/position", authMiddleware(http.HandlerFunc(articlePositionHandler)))
+	mux.Handle("/api/search", authMiddleware(http.HandlerFunc(searchHandler)))
+	mux.Handle("/api/smart-feeds", authMiddleware(http.HandlerFunc(smartFeedsHandler)))
+	mux.Handle("/api/rules", authMiddleware(http.HandlerFunc(rulesHandler)))
+	mux.Handle("/api/rules/dry-run", authMiddleware(http.HandlerFunc(ruleDryRunHandler)))
 	mux.Handle("/upload-opml", authMiddleware(http.HandlerFunc(uploadOPMLHandler)))
 	mux.Handle("/export-opml", authMiddleware(http.HandlerFunc(exportOPMLHandler)))
 	mux.Handle("/clear-cache", authMiddleware(http.HandlerFunc(clearCacheHandler)))
 	mux.Handle("/logout", authMiddleware(http.HandlerFunc(logoutHandler)))
+	mux.Handle("/api/sessions", authMiddleware(http.HandlerFunc(sessionsAPIHandler)))
+	mux.Handle("/api/sessions/revoke", authMiddleware(http.HandlerFunc(revokeSessionHandler)))
 
 	log.Println("🚀 Starting ANCAP WEB Server with Authentication...")
 	log.Println("🌐 Server running at http://localhost:8082")
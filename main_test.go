@@ -0,0 +1,358 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"ancap-web/internal/storage"
+)
+
+func TestNormalizeFeedURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "https://example.com/feed", want: "https://example.com/feed"},
+		{raw: "https://example.com/feed/", want: "https://example.com/feed"},
+		{raw: "https://example.com/", want: "https://example.com"},
+		{raw: "https://example.com", want: "https://example.com"},
+		{raw: "HTTPS://Example.COM/Feed/", want: "https://example.com/Feed"},
+		{raw: "http://example.com:80/rss", want: "http://example.com/rss"},
+		{raw: "https://example.com:443/rss", want: "https://example.com/rss"},
+		{raw: "https://example.com:8443/rss", want: "https://example.com:8443/rss"},
+		{raw: "http://example.com:443/rss", want: "http://example.com:443/rss"},
+		{raw: "https://example.com/feed#top", want: "https://example.com/feed"},
+		{raw: "https://example.com/?feed=rss2", want: "https://example.com?feed=rss2"},
+		{raw: "https://example.com/feed?Format=RSS", want: "https://example.com/feed?Format=RSS"},
+		{raw: "  https://example.com/feed  ", want: "https://example.com/feed"},
+		{raw: "ftp://example.com/feed", wantErr: true},
+		{raw: "example.com/feed", wantErr: true},
+		{raw: "https://", wantErr: true},
+		{raw: "http://[::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeFeedURL(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeFeedURL(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeFeedURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestPaginateRiver(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC) }
+	// En el orden de riverArticles: más recientes primero y, a igual fecha, por ID
+	river := []Article{
+		{ID: "a", Published: at(12)},
+		{ID: "b", Published: at(11)},
+		{ID: "c", Published: at(10)},
+		{ID: "d", Published: at(10)},
+		{ID: "e", Published: at(9)},
+	}
+	without := func(id string) []Article {
+		var list []Article
+		for _, a := range river {
+			if a.ID != id {
+				list = append(list, a)
+			}
+		}
+		return list
+	}
+	cursorAt := func(id string) string {
+		for _, a := range river {
+			if a.ID == id {
+				return encodeRiverCursor(a)
+			}
+		}
+		t.Fatalf("no article %q", id)
+		return ""
+	}
+
+	tests := []struct {
+		name     string
+		articles []Article
+		cursor   string
+		limit    int
+		want     []string
+		wantNext string
+	}{
+		{name: "first page", articles: river, limit: 2, want: []string{"a", "b"}, wantNext: cursorAt("b")},
+		{name: "middle page", articles: river, cursor: cursorAt("b"), limit: 2, want: []string{"c", "d"}, wantNext: cursorAt("d")},
+		{name: "same date splits by ID", articles: river, cursor: cursorAt("c"), limit: 1, want: []string{"d"}, wantNext: cursorAt("d")},
+		{name: "last page", articles: river, cursor: cursorAt("d"), limit: 2, want: []string{"e"}},
+		{name: "page ends exactly at the end", articles: river, cursor: cursorAt("c"), limit: 2, want: []string{"d", "e"}},
+		{name: "cursor at end of list", articles: river, cursor: cursorAt("e"), limit: 2, want: []string{}},
+		{name: "everything fits", articles: river, limit: 10, want: []string{"a", "b", "c", "d", "e"}},
+		{name: "empty river", articles: nil, limit: 2, want: []string{}},
+		// El artículo del cursor ya no está (leído o caducado): se sigue por el siguiente
+		{name: "stale cursor", articles: without("b"), cursor: cursorAt("b"), limit: 2, want: []string{"c", "d"}, wantNext: cursorAt("d")},
+		{name: "stale cursor at same date", articles: without("c"), cursor: cursorAt("c"), limit: 5, want: []string{"d", "e"}},
+		{name: "stale cursor past the end", articles: without("e"), cursor: cursorAt("e"), limit: 2, want: []string{}},
+		{name: "invalid cursor starts over", articles: river, cursor: "%%%", limit: 1, want: []string{"a"}, wantNext: cursorAt("a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, next := paginateRiver(tt.articles, tt.cursor, tt.limit)
+			ids := []string{}
+			for _, a := range page {
+				ids = append(ids, a.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("page = %v, want %v", ids, tt.want)
+			}
+			if next != tt.wantNext {
+				t.Errorf("next cursor = %q, want %q", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"100.128.0.1", true},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestParseRiverFilter(t *testing.T) {
+	madrid := time.FixedZone("CEST", 2*3600)
+	tests := []struct {
+		name    string
+		query   string
+		want    riverFilter
+		wantErr string
+	}{
+		{name: "empty", query: "", want: riverFilter{}},
+		{name: "unknown params are ignored", query: "foo=bar&page=2", want: riverFilter{}},
+		{name: "source", query: "source=+Mises+Wire+", want: riverFilter{Source: "Mises Wire"}},
+		{name: "category trims slashes", query: "category=/Economía/Austriaca/", want: riverFilter{Category: "Economía/Austriaca"}},
+		{name: "unread=0 shows read", query: "unread=0", want: riverFilter{ShowAll: true}},
+		{name: "legacy show=all", query: "show=all", want: riverFilter{ShowAll: true}},
+		{name: "unread=1 keeps hiding read", query: "unread=1", want: riverFilter{}},
+		{name: "tag without hash", query: "tag=%23Cripto", want: riverFilter{Tag: "cripto"}},
+		{
+			name:  "combined",
+			query: "feed=https://example.com/rss&category=Blogs&source=reddit&unread=0&episodes=1&priority=1&muted=1&smart=s1",
+			want: riverFilter{
+				Feed: "https://example.com/rss", Category: "Blogs", Source: "reddit", ShowAll: true,
+				Episodes: true, Priority: true, Muted: true, Smart: "s1",
+			},
+		},
+		{
+			name:  "dates in the user's zone, until includes the day",
+			query: "since=2024-05-01&until=2024-05-02",
+			want: riverFilter{
+				Since: time.Date(2024, 5, 1, 0, 0, 0, 0, madrid),
+				Until: time.Date(2024, 5, 3, 0, 0, 0, 0, madrid),
+			},
+		},
+		{
+			name:  "RFC3339 dates are taken as they are",
+			query: "until=2024-05-02T10:00:00Z",
+			want:  riverFilter{Until: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "bad date keeps the rest",
+			query:   "source=reddit&since=ayer",
+			want:    riverFilter{Source: "reddit"},
+			wantErr: `invalid since "ayer"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseRiverFilter(query, madrid)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("error = %q, want %q", gotErr, tt.wantErr)
+			}
+			if !got.Since.Equal(tt.want.Since) || !got.Until.Equal(tt.want.Until) {
+				t.Errorf("dates = %v..%v, want %v..%v", got.Since, got.Until, tt.want.Since, tt.want.Until)
+			}
+			got.Since, got.Until, tt.want.Since, tt.want.Until = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRiverFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRiverFilterIncludesFeed(t *testing.T) {
+	feed := Feed{URL: "https://example.com/rss", Active: true, Category: "Economía/Austriaca"}
+	inactive := Feed{URL: "https://example.com/old", Category: "Economía"}
+	tests := []struct {
+		name   string
+		filter riverFilter
+		feed   Feed
+		want   bool
+	}{
+		{"no filter", riverFilter{}, feed, true},
+		{"inactive feed", riverFilter{}, inactive, false},
+		{"single feed even if inactive", riverFilter{Feed: inactive.URL}, inactive, true},
+		{"other feed", riverFilter{Feed: inactive.URL}, feed, false},
+		{"category", riverFilter{Category: "Economía/Austriaca"}, feed, true},
+		{"parent category", riverFilter{Category: "Economía"}, feed, true},
+		{"category prefix is not a parent", riverFilter{Category: "Econo"}, feed, false},
+		{"category of an inactive feed", riverFilter{Category: "Economía"}, inactive, false},
+		{"feed wins over category", riverFilter{Feed: feed.URL, Category: "Deportes"}, feed, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.includesFeed(tt.feed); got != tt.want {
+			t.Errorf("%s: includesFeed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRiverFilterIncludesArticle(t *testing.T) {
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	article := Article{Source: "Mises Wire", Published: published, Tags: []string{"cripto"}}
+	read := article
+	read.Read = true
+	hidden := article
+	hidden.Hidden = true
+	priority := article
+	priority.Priority = true
+	episode := article
+	episode.Enclosures = []storage.Enclosure{{URL: "https://example.com/a.mp3", Type: "audio/mpeg"}}
+	tests := []struct {
+		name    string
+		filter  riverFilter
+		article Article
+		want    bool
+	}{
+		{"no filter", riverFilter{}, article, true},
+		{"source contains, any case", riverFilter{Source: "mises"}, article, true},
+		{"other source", riverFilter{Source: "reddit"}, article, false},
+		{"read is hidden by default", riverFilter{}, read, false},
+		{"read with unread=0", riverFilter{ShowAll: true}, read, true},
+		{"muted is hidden by default", riverFilter{}, hidden, false},
+		{"muted with muted=1", riverFilter{Muted: true}, hidden, true},
+		{"priority only", riverFilter{Priority: true}, article, false},
+		{"priority", riverFilter{Priority: true}, priority, true},
+		{"tag", riverFilter{Tag: "cripto"}, article, true},
+		{"other tag", riverFilter{Tag: "deportes"}, article, false},
+		{"episodes only", riverFilter{Episodes: true}, article, false},
+		{"episode", riverFilter{Episodes: true}, episode, true},
+		{"since is inclusive", riverFilter{Since: published}, article, true},
+		{"until is exclusive", riverFilter{Until: published}, article, false},
+		{"inside the dates", riverFilter{Since: published.Add(-time.Hour), Until: published.Add(time.Hour)}, article, true},
+		{"combined", riverFilter{Source: "wire", ShowAll: true, Tag: "cripto", Since: published}, read, true},
+		{"combined, one fails", riverFilter{Source: "wire", ShowAll: true, Tag: "deportes"}, read, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.includesArticle(tt.article); got != tt.want {
+			t.Errorf("%s: includesArticle() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUTF8HTMLBody(t *testing.T) {
+	latin1 := "caf\xe9 \x93espa\xf1a\x94" // "café “españa”" en Windows-1252
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"utf-8 without declaration", "text/html", "<p>café “españa”</p>", "café “españa”"},
+		{"windows-1252 without declaration", "text/html", "<p>" + latin1 + "</p>", "café “españa”"},
+		{"latin-1 only in meta charset", "text/html", `<meta charset="iso-8859-1"><p>` + latin1 + "</p>", "café “españa”"},
+		{"latin-1 only in http-equiv", "", `<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-1"><p>` + latin1 + "</p>", "café “españa”"},
+		{"windows-1252 only in the header", "text/html; charset=windows-1252", "<p>" + latin1 + "</p>", "café “españa”"},
+		{"header wins over meta", "text/html; charset=utf-8", `<meta charset="iso-8859-1"><p>café</p>`, "café"},
+		{"BOM wins over header and meta", "text/html; charset=iso-8859-1", "\xef\xbb\xbf" + `<meta charset="iso-8859-1"><p>café</p>`, "café"},
+		{"utf-16 BOM", "text/html; charset=utf-8", "\xff\xfe<\x00p\x00>\x00c\x00a\x00f\x00\xe9\x00<\x00/\x00p\x00>\x00", "café"},
+		{"unknown charset falls back", "text/html; charset=x-nada", "<p>café</p>", "café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+			if tt.contentType != "" {
+				resp.Header.Set("Content-Type", tt.contentType)
+			}
+			body, err := utf8HTMLBody(resp, 1<<20)
+			if err != nil {
+				t.Fatalf("utf8HTMLBody: %v", err)
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !utf8.Valid(data) || !strings.Contains(string(data), tt.want) {
+				t.Errorf("body = %q, want it to contain %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrapeArticleContentCharset(t *testing.T) {
+	paragraph := strings.Repeat("El caf\xe9 de la ma\xf1ana, con az\xfacar y sin planificaci\xf3n central. ", 4)
+	pages := map[string]struct{ contentType, body string }{
+		"/meta":   {"text/html", `<html><head><meta charset="iso-8859-1"></head><body><article><p>` + paragraph + `</p></article></body></html>`},
+		"/header": {"text/html; charset=windows-1252", `<html><body><article><p>` + paragraph + `</p></article></body></html>`},
+		"/none":   {"text/html", `<html><body><article><p>` + paragraph + `</p></article></body></html>`},
+		"/bom":    {"text/html; charset=iso-8859-1", "\xef\xbb\xbf<html><body><article><p>" + strings.Repeat("El café de la mañana, con azúcar y sin planificación central. ", 4) + "</p></article></body></html>"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", page.contentType)
+		io.WriteString(w, page.body)
+	}))
+	defer server.Close()
+
+	for path := range pages {
+		content, err := scrapeArticleContent(server.URL + path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !strings.Contains(content, "El café de la mañana, con azúcar y sin planificación") {
+			t.Errorf("%s: content = %q", path, content)
+		}
+	}
+}